@@ -4,8 +4,6 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,10 +15,12 @@ import (
 )
 
 var (
-	flagLocalDir   = flag.String("l", "", "local")
-	flagRemoteDir  = flag.String("r", "", "remote")
-	flagAlias      = flag.String("a", "", "alias")
-	flagConfigPath = flag.String("c", "", "config")
+	flagLocalDir    = flag.String("l", "", "local")
+	flagRemoteDir   = flag.String("r", "", "remote")
+	flagAlias       = flag.String("a", "", "alias")
+	flagConfigPath  = flag.String("c", "", "config")
+	flagParallelism = flag.Int("p", 4, "parallelism")
+	flagBandwidth   = flag.Int64("bw", 0, "bandwidth limit bytes/s")
 )
 
 func main() {
@@ -52,22 +52,16 @@ func copyDirToRemote(aliasCfg interface{}, ld, rd *string) {
 	if err != nil {
 		panic(err)
 	}
-	err = filepath.Walk(*ld, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-		locRelativePath := strings.TrimPrefix(path, *ld)
-		realS3Path := fmt.Sprintf("%s%s", *rd, locRelativePath)
-		relativePath := strings.TrimPrefix(path, "/")
-		err = filesystem.CopyRaw(lbs, rbs, relativePath, realS3Path)
-		if err != nil {
-			return err
-		}
-		return nil
+	if *flagBandwidth > 0 {
+		rbs = filesystem.WithRateLimit(rbs, filesystem.NewLimiter(filesystem.RateLimits{BytesPerSecond: *flagBandwidth}))
+	}
+	stats, err := filesystem.CopyDir(lbs, rbs, strings.TrimPrefix(*ld, "/"), *rd, filesystem.CopyDirOptions{
+		Parallelism: *flagParallelism,
 	})
 	if err != nil {
 		panic(err)
 	}
+	fmt.Printf("copied %d files, %d bytes in %v\n", stats.Files, stats.Bytes, stats.Duration)
 }
 
 func loadRcloneConfig() rc.Params {
@@ -1,9 +1,11 @@
 package filesystem
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"time"
 )
 
@@ -15,6 +17,7 @@ const (
 	KindCFS       = "cfs"
 	KindGlusterFS = "glusterfs"
 	KindS3        = "s3"
+	KindMem       = "mem"
 )
 
 func NewBlobStore(kind Kind, endpoint string, config map[string]string) (BlobStore, error) {
@@ -23,6 +26,10 @@ func NewBlobStore(kind Kind, endpoint string, config map[string]string) (BlobSto
 		return newS3BlobStore(endpoint, config)
 	case KindLocal:
 		return newLocalBlobStore(endpoint, config)
+	case KindNFS, KindCFS, KindGlusterFS:
+		return newMountBlobStore(kind, endpoint, config)
+	case KindMem:
+		return newMemBlobStore(endpoint, config)
 	}
 	return nil, fmt.Errorf("kind %s unsupported", kind)
 }
@@ -48,6 +55,24 @@ type BlobStore interface {
 	BuildURL(path string) (string, error)
 }
 
+// ContextBlobStore is the context-aware variant of BlobStore, ctx can cancel or time-box every call
+type ContextBlobStore interface {
+	ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error)
+
+	GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error)
+
+	// ReadRawWithContext the returned stream stops reading once ctx is done
+	ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error)
+
+	WriteRawWithContext(ctx context.Context, path string, in io.Reader) error
+
+	DeleteRawWithContext(ctx context.Context, path string) error
+
+	GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error)
+
+	BuildURL(path string) (string, error)
+}
+
 type ListMetaOption struct {
 	// support: s3/file
 	DirectoryOnly bool
@@ -56,6 +81,9 @@ type ListMetaOption struct {
 	MaxKeys int64
 	// support: s3
 	StartAfter string
+	// support: s3
+	// 自动翻页直到列举完成, 此时MaxKeys只作为每页大小
+	AllPages bool
 }
 
 type BlobMeta struct {
@@ -69,19 +97,46 @@ type BlobMeta struct {
 	URLPath string `json:"urlPath"`
 	// LastModified last modified time the object.
 	LastModified time.Time `json:"lastModified"`
+	// ContentEncoding, CacheControl, StorageClass and Metadata are stored by WriteRawWithOptions
+	// and only provided in GetMeta
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	CacheControl    string            `json:"cacheControl,omitempty"`
+	StorageClass    string            `json:"storageClass,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	// IsDir directories of file stores, common prefixes of s3
+	IsDir bool `json:"isDir,omitempty"`
+	// ETag s3 etag without quotes, the md5 of mem objects, size and mtime of local files
+	ETag string `json:"etag,omitempty"`
+	// Checksum like "sha256:<base64>", only provided in GetMeta when the object was stored with a checksum
+	Checksum string `json:"checksum,omitempty"`
+	// VersionID only provides in GetMeta on versioned s3 buckets
+	VersionID string `json:"versionId,omitempty"`
+	// Mode only provides by file stores
+	Mode os.FileMode `json:"mode,omitempty"`
 }
 
 func CopyRaw(sourceBS, destBS BlobStore, sourcePath, destPath string) error {
+	return CopyRawWithContext(context.Background(), sourceBS, destBS, sourcePath, destPath)
+}
+
+func CopyRawWithContext(ctx context.Context, sourceBS, destBS BlobStore, sourcePath, destPath string) error {
 	if sourceBS == nil {
 		return errors.New("source blobstore is required")
 	}
 	if destBS == nil {
 		destBS = sourceBS
 	}
-	stream, err := sourceBS.ReadRaw(sourcePath)
+	if copier, ok := destBS.(Copier); ok {
+		err := copier.CopyRawFrom(ctx, sourceBS, sourcePath, destPath)
+		if !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+	source, dest := WithContext(sourceBS), WithContext(destBS)
+	stream, err := source.ReadRawWithContext(ctx, sourcePath)
 	if err != nil {
 		return err
 	}
 	defer stream.Close()
-	return destBS.WriteRaw(destPath, stream)
+	return dest.WriteRawWithContext(ctx, destPath, stream)
 }
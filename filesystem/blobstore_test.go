@@ -3,6 +3,7 @@ package filesystem
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"strings"
 	"testing"
@@ -15,6 +16,7 @@ var bsSet = make(map[string]BlobStore)
 const (
 	BlobStoreMinio = "minio"
 	BlobStoreLocal = "local"
+	BlobStoreMem   = "mem"
 )
 
 func TestMain(m *testing.M) {
@@ -28,15 +30,43 @@ func TestMain(m *testing.M) {
 			ConfigDisableSSL: "false",
 		})
 	if err != nil {
-		panic("init minio failed " + err.Error())
+		// the other backends are still tested offline
+		log.Printf("init minio failed, skipping its tests: %v", err)
+		delete(bsSet, BlobStoreMinio)
 	}
 	bsSet[BlobStoreLocal], err = NewBlobStore(KindLocal, "./", nil)
 	if err != nil {
 		panic("init local fs failed " + err.Error())
 	}
+	bsSet[BlobStoreMem], err = NewBlobStore(KindMem, "my-bucket", nil)
+	if err != nil {
+		panic("init mem failed " + err.Error())
+	}
 	os.Exit(m.Run())
 }
 
+// newTestBlobStores a local store rooted in a temp dir and an empty mem store, keyed like bsSet
+func newTestBlobStores(t *testing.T) map[string]BlobStore {
+	local, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	mem, err := NewBlobStore(KindMem, "my-bucket", nil)
+	if err != nil {
+		t.Fatalf("new mem blob store error: %v", err)
+	}
+	return map[string]BlobStore{BlobStoreLocal: local, BlobStoreMem: mem}
+}
+
+// minioBlobStore skips the test if the minio store could not be initialized
+func minioBlobStore(t *testing.T) BlobStore {
+	bs, ok := bsSet[BlobStoreMinio]
+	if !ok {
+		t.Skip("minio is unreachable")
+	}
+	return bs
+}
+
 func TestWriteRaw(t *testing.T) {
 	testCases := []struct {
 		name       string
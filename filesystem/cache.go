@@ -0,0 +1,454 @@
+package filesystem
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheMaxBytes = 1 << 30
+
+// CacheOptions of WithCache
+type CacheOptions struct {
+	// Dir local directory of the cached bodies, they are kept across restarts
+	Dir string
+	// MaxBytes bound of the cached bodies, the least recently used are evicted. 0 uses 1GiB.
+	MaxBytes int64
+	// WriteThrough caches the bodies written through the store, otherwise a write only drops the cached body
+	WriteThrough bool
+}
+
+// CacheStats counters of the cache of WithCache
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Evictions     int64
+	Invalidations int64
+	Objects       int64
+	Bytes         int64
+}
+
+// CacheReporter is implemented by the stores returned by WithCache
+type CacheReporter interface {
+	CacheStats() CacheStats
+}
+
+// WithCache returns bs caching the bodies of ReadRaw in a local directory.
+// Each read validates the cached body against the ETag, or the LastModified and Size, of GetMeta,
+// concurrent misses of an object share a single read of bs. Writes, deletes and copies through
+// the returned store drop the cached body, writes of another client are seen by the validation.
+// The returned store implements CacheReporter.
+func WithCache(bs BlobStore, opts CacheOptions) (BlobStore, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("%w: cache dir is required", ErrInvalidPath)
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultCacheMaxBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &diskCache{
+		inner:        bs,
+		dir:          opts.Dir,
+		maxBytes:     opts.MaxBytes,
+		writeThrough: opts.WriteThrough,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+		fills:        make(map[string]*cacheFill),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return &cacheBlobStore{wrappedBlobStore: &wrappedBlobStore{inner: bs, mw: c}, cache: c}, nil
+}
+
+type cacheBlobStore struct {
+	*wrappedBlobStore
+	cache *diskCache
+}
+
+var _ CacheReporter = &cacheBlobStore{}
+
+func (c *cacheBlobStore) CacheStats() CacheStats {
+	return c.cache.statsSnapshot()
+}
+
+// diskCache the middleware of WithCache. A body is stored in dir as "<object>.<version>",
+// hashes of the url of the object and of its version.
+type diskCache struct {
+	inner        BlobStore
+	dir          string
+	maxBytes     int64
+	writeThrough bool
+
+	mu sync.Mutex
+	// entries by object, the lru front is the most recently used
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	// fills the reads of the missed bodies, by file name
+	fills map[string]*cacheFill
+	stats CacheStats
+}
+
+type cacheEntry struct {
+	object  string
+	version string
+	size    int64
+}
+
+func (e *cacheEntry) name() string {
+	return e.object + "." + e.version
+}
+
+// cacheFill a read of bs shared by the concurrent misses of a body
+type cacheFill struct {
+	done chan struct{}
+	err  error
+}
+
+var _ middleware = &diskCache{}
+
+func cacheHash(s string, size int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:size])
+}
+
+func (c *diskCache) object(path string) string {
+	if u, err := c.inner.BuildURL(path); err == nil {
+		path = u
+	}
+	return cacheHash(path, 16)
+}
+
+func cacheVersion(meta *BlobMeta) string {
+	if meta.ETag != "" {
+		return cacheHash("etag:"+meta.ETag, 8)
+	}
+	return cacheHash(strconv.FormatInt(meta.LastModified.UnixNano(), 10)+":"+strconv.FormatInt(meta.Size, 10), 8)
+}
+
+func parseCacheName(name string) (object, version string, ok bool) {
+	object, version, ok = strings.Cut(name, ".")
+	if !ok || len(object) != 32 || len(version) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(object + version); err != nil {
+		return "", "", false
+	}
+	return object, version, true
+}
+
+// load indexes the bodies cached by a previous run, the most recently written first
+func (c *diskCache) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	type cached struct {
+		entry   *cacheEntry
+		modTime time.Time
+	}
+	var files []cached
+	for _, dirEntry := range dirEntries {
+		if isLocalTempName(dirEntry.Name()) {
+			os.Remove(filepath.Join(c.dir, dirEntry.Name()))
+			continue
+		}
+		object, version, ok := parseCacheName(dirEntry.Name())
+		if !ok || !dirEntry.Type().IsRegular() {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cached{entry: &cacheEntry{object: object, version: version, size: info.Size()}, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, file := range files {
+		c.insert(file.entry)
+	}
+	return nil
+}
+
+func (c *diskCache) path(entry *cacheEntry) string {
+	return filepath.Join(c.dir, entry.name())
+}
+
+// insert adds entry in front of the lru, replacing the other version of the object, then evicts
+// the least recently used bodies over maxBytes. c.mu must be held.
+func (c *diskCache) insert(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.object]; ok {
+		if old := elem.Value.(*cacheEntry); old.version != entry.version {
+			os.Remove(c.path(old))
+		}
+		c.remove(elem)
+	}
+	c.entries[entry.object] = c.lru.PushFront(entry)
+	c.size += entry.size
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		elem := c.lru.Back()
+		os.Remove(c.path(elem.Value.(*cacheEntry)))
+		c.remove(elem)
+		c.stats.Evictions++
+	}
+}
+
+// remove drops elem from the index, c.mu must be held
+func (c *diskCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.object)
+	c.size -= entry.size
+}
+
+// invalidate drops the cached body of object
+func (c *diskCache) invalidate(object string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[object]; ok {
+		os.Remove(c.path(elem.Value.(*cacheEntry)))
+		c.remove(elem)
+		c.stats.Invalidations++
+	}
+}
+
+// invalidateEntry drops the cached body of entry, unless another version was cached meanwhile
+func (c *diskCache) invalidateEntry(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.object]; ok && elem.Value.(*cacheEntry).version == entry.version {
+		os.Remove(c.path(entry))
+		c.remove(elem)
+		c.stats.Invalidations++
+	}
+}
+
+func (c *diskCache) statsSnapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Objects, stats.Bytes = int64(c.lru.Len()), c.size
+	return stats
+}
+
+// call drops the cached body of the path deleted or copied to
+func (c *diskCache) call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if op == opDeleteRaw || op == opCopyRawFrom {
+		c.invalidate(c.object(path))
+	}
+	return err
+}
+
+func (c *diskCache) download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error) {
+	return fn(ctx, wa)
+}
+
+// read serves ReadRaw from the cache, the ranged reads go to the store
+func (c *diskCache) read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if op != opReadRaw {
+		return fn(ctx)
+	}
+	meta, err := WithContext(c.inner).GetMetaWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if meta.IsDir || meta.Size > c.maxBytes {
+		return fn(ctx)
+	}
+	entry := &cacheEntry{object: c.object(path), version: cacheVersion(meta), size: meta.Size}
+	for {
+		c.mu.Lock()
+		if elem, ok := c.entries[entry.object]; ok && elem.Value.(*cacheEntry).version == entry.version {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			file, err := os.Open(c.path(entry))
+			if err == nil {
+				c.mu.Lock()
+				c.stats.Hits++
+				c.mu.Unlock()
+				return file, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			// removed behind the back of the cache
+			c.invalidateEntry(entry)
+			continue
+		}
+		fill, ok := c.fills[entry.name()]
+		if !ok {
+			fill = &cacheFill{done: make(chan struct{})}
+			c.fills[entry.name()] = fill
+			c.stats.Misses++
+			c.mu.Unlock()
+
+			file, err := c.fill(ctx, entry, fn)
+			c.mu.Lock()
+			delete(c.fills, entry.name())
+			c.mu.Unlock()
+			fill.err = err
+			close(fill.done)
+			return file, err
+		}
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-fill.done:
+		}
+		// a failed fill is tried again by each waiting read with its own context
+	}
+}
+
+// fill reads the body from the store into the cache and returns it opened
+func (c *diskCache) fill(ctx context.Context, entry *cacheEntry, fn func(ctx context.Context) (io.ReadCloser, error)) (*os.File, error) {
+	rc, err := fn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tmp, err := createAtomicFile(c.path(entry), 0644, false)
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.abort()
+	n, err := io.Copy(tmp, rc)
+	if err != nil {
+		return nil, err
+	}
+	if n != entry.size {
+		// the object changed since GetMeta, the body read is served once without being cached
+		tmp.done = true
+		os.Remove(tmp.Name())
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		return tmp.File, nil
+	}
+	if err = tmp.commit(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(entry)
+	// opened under the lock so it cannot be evicted first
+	return os.Open(c.path(entry))
+}
+
+// write drops the cached body, with WriteThrough the written body is cached once the store has it
+func (c *diskCache) write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error {
+	object := c.object(path)
+	c.invalidate(object)
+	if !c.writeThrough {
+		err := fn(ctx, in)
+		c.invalidate(object)
+		return err
+	}
+	tmp, err := createAtomicFile(filepath.Join(c.dir, object), 0644, false)
+	if err != nil {
+		return fn(ctx, in)
+	}
+	defer tmp.abort()
+	tee := newCacheTee(in, tmp.File, c.maxBytes)
+	if err = fn(ctx, tee.reader()); err != nil {
+		c.invalidate(object)
+		return err
+	}
+	meta, err := WithContext(c.inner).GetMetaWithContext(ctx, path)
+	if err != nil || tee.err != nil || tee.off != meta.Size || meta.Size > c.maxBytes {
+		return nil
+	}
+	entry := &cacheEntry{object: object, version: cacheVersion(meta), size: meta.Size}
+	tmp.path = c.path(entry)
+	if tmp.Truncate(meta.Size) != nil || tmp.commit() != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(entry)
+	return nil
+}
+
+// cacheTee copies the bytes read from r into w at their offset from the start of r, so a seek
+// back to retry the write rewrites the same bytes. A failed write to w does not fail the read,
+// nor does a body over max bytes, which is not copied any further.
+type cacheTee struct {
+	r   io.Reader
+	w   io.WriterAt
+	max int64
+	// seeker is nil if r cannot seek
+	seeker io.Seeker
+	start  int64
+	off    int64
+	err    error
+}
+
+var errCacheTeeTooLarge = errors.New("body too large to be cached")
+
+func newCacheTee(r io.Reader, w io.WriterAt, max int64) *cacheTee {
+	tee := &cacheTee{r: r, w: w, max: max}
+	if seeker, ok := r.(io.Seeker); ok {
+		// a reader that cannot tell its offset is not rewound either
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			tee.seeker, tee.start = seeker, start
+		}
+	}
+	return tee
+}
+
+// reader the reader to write, it can seek if r can
+func (t *cacheTee) reader() io.Reader {
+	if t.seeker != nil {
+		return &cacheTeeSeeker{cacheTee: t}
+	}
+	return t
+}
+
+func (t *cacheTee) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && t.err == nil && t.off+int64(n) > t.max {
+		t.err = errCacheTeeTooLarge
+	}
+	if n > 0 && t.err == nil {
+		if _, t.err = t.w.WriteAt(p[:n], t.off); t.err == nil {
+			t.off += int64(n)
+		}
+	}
+	return n, err
+}
+
+type cacheTeeSeeker struct {
+	*cacheTee
+}
+
+func (t *cacheTeeSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := t.seeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if t.off = pos - t.start; t.off < 0 {
+		t.err = errors.New("seek before the start of the write")
+	}
+	return pos, nil
+}
@@ -0,0 +1,217 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingBlobStore counts the reads of the store, they wait for release when it is set
+type countingBlobStore struct {
+	BlobStore
+	reads   int64
+	release chan struct{}
+}
+
+func (bs *countingBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	atomic.AddInt64(&bs.reads, 1)
+	if bs.release != nil {
+		<-bs.release
+	}
+	return bs.BlobStore.ReadRaw(path)
+}
+
+func readString(t *testing.T, bs BlobStore, path string) string {
+	t.Helper()
+	stream, err := bs.ReadRaw(path)
+	if err != nil {
+		t.Fatalf("read raw %s error: %v", path, err)
+	}
+	defer stream.Close()
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read %s error: %v", path, err)
+	}
+	return string(content)
+}
+
+func TestWithCache(t *testing.T) {
+	inner := &countingBlobStore{BlobStore: newTestMemBlobStore(t, "a", "b")}
+	dir := t.TempDir()
+	bs, err := WithCache(inner, CacheOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := readString(t, bs, "a"); got != "a" {
+			t.Fatalf("content: %q", got)
+		}
+	}
+	if inner.reads != 1 {
+		t.Fatalf("reads of the store: %d, want 1", inner.reads)
+	}
+	if stats := bs.(CacheReporter).CacheStats(); stats != (CacheStats{Hits: 1, Misses: 1, Objects: 1, Bytes: 1}) {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	// a write of another client is seen by the validation
+	if err = inner.WriteRaw("a", strings.NewReader("a2")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if got := readString(t, bs, "a"); got != "a2" || inner.reads != 2 {
+		t.Fatalf("content after an outside write: %q after %d reads", got, inner.reads)
+	}
+
+	// a write through the cache drops the body
+	if err = bs.WriteRaw("a", strings.NewReader("a3")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if stats := bs.(CacheReporter).CacheStats(); stats.Objects != 0 || stats.Invalidations != 1 {
+		t.Fatalf("stats after a write: %+v", stats)
+	}
+	if got := readString(t, bs, "a"); got != "a3" || inner.reads != 3 {
+		t.Fatalf("content after a write: %q after %d reads", got, inner.reads)
+	}
+
+	// the bodies are kept across restarts
+	bs, err = WithCache(inner, CacheOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	if got := readString(t, bs, "a"); got != "a3" || inner.reads != 3 {
+		t.Fatalf("content after a restart: %q after %d reads", got, inner.reads)
+	}
+
+	if err = bs.DeleteRaw("a"); err != nil {
+		t.Fatalf("delete raw error: %v", err)
+	}
+	if stats := bs.(CacheReporter).CacheStats(); stats.Objects != 0 {
+		t.Fatalf("stats after a delete: %+v", stats)
+	}
+	if _, err = bs.ReadRaw("a"); err == nil {
+		t.Fatalf("read of a deleted path succeeded")
+	}
+}
+
+func TestWithCacheEviction(t *testing.T) {
+	inner := &countingBlobStore{BlobStore: newTestMemBlobStore(t, "aaaa", "bbbb", "cccc", "dddddddddddd")}
+	bs, err := WithCache(inner, CacheOptions{Dir: t.TempDir(), MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	for _, path := range []string{"aaaa", "bbbb", "aaaa", "cccc", "aaaa", "bbbb"} {
+		readString(t, bs, path)
+	}
+	// bbbb was the least recently used when cccc was cached
+	if stats := bs.(CacheReporter).CacheStats(); stats.Hits != 2 || stats.Misses != 4 || stats.Evictions != 2 || stats.Bytes != 8 {
+		t.Fatalf("stats: %+v", stats)
+	}
+	// larger than the cache, read from the store
+	readString(t, bs, "dddddddddddd")
+	readString(t, bs, "dddddddddddd")
+	if stats := bs.(CacheReporter).CacheStats(); stats.Misses != 4 || inner.reads != 6 {
+		t.Fatalf("stats after reading a large object: %+v after %d reads", stats, inner.reads)
+	}
+}
+
+func TestWithCacheSingleFlight(t *testing.T) {
+	inner := &countingBlobStore{BlobStore: newTestMemBlobStore(t, "a"), release: make(chan struct{})}
+	bs, err := WithCache(inner, CacheOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	var wg sync.WaitGroup
+	contents := make([]string, 8)
+	for i := range contents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stream, err := WithContext(bs).ReadRawWithContext(context.Background(), "a")
+			if err != nil {
+				t.Errorf("read raw error: %v", err)
+				return
+			}
+			defer stream.Close()
+			content, _ := ioutil.ReadAll(stream)
+			contents[i] = string(content)
+		}(i)
+	}
+	close(inner.release)
+	wg.Wait()
+	for _, content := range contents {
+		if content != "a" {
+			t.Fatalf("contents: %q", contents)
+		}
+	}
+	if inner.reads != 1 {
+		t.Fatalf("reads of the store: %d, want 1", inner.reads)
+	}
+}
+
+func TestWithCacheWriteThrough(t *testing.T) {
+	inner := &countingBlobStore{BlobStore: newTestMemBlobStore(t)}
+	bs, err := WithCache(WithRetry(inner, RetryOptions{}), CacheOptions{Dir: t.TempDir(), WriteThrough: true})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	if err = bs.WriteRaw("a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if err = bs.WriteRaw("b", ioutil.NopCloser(strings.NewReader("world"))); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if got := readString(t, bs, "a") + readString(t, bs, "b"); got != "helloworld" || inner.reads != 0 {
+		t.Fatalf("content: %q after %d reads", got, inner.reads)
+	}
+	if stats := bs.(CacheReporter).CacheStats(); stats.Hits != 2 || stats.Objects != 2 {
+		t.Fatalf("stats: %+v", stats)
+	}
+}
+
+func TestWithCacheWriteThroughRetried(t *testing.T) {
+	inner := &countingBlobStore{BlobStore: newTestMemBlobStore(t)}
+	flaky := &flakyBlobStore{BlobStore: inner, err: ErrThrottled, failures: 1}
+	bs, err := WithCache(WithRetry(flaky, RetryOptions{Policy: testRetryPolicy}), CacheOptions{Dir: t.TempDir(), WriteThrough: true})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	// the retry seeks back, the cached body is written again from the start
+	if err = bs.WriteRaw("a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if got := readString(t, bs, "a"); got != "hello" || inner.reads != 0 {
+		t.Fatalf("content: %q after %d reads", got, inner.reads)
+	}
+}
+
+func TestCacheTeeMaxBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tee := newCacheTee(strings.NewReader("hello world"), &bufferWriterAt{buf: buf}, 5)
+	content, err := ioutil.ReadAll(tee.reader())
+	if err != nil || string(content) != "hello world" {
+		t.Fatalf("read %q: %v", content, err)
+	}
+	if buf.Len() > 5 || tee.err != errCacheTeeTooLarge {
+		t.Fatalf("teed %d bytes: %v", buf.Len(), tee.err)
+	}
+}
+
+func TestWithCacheInvalidateEntry(t *testing.T) {
+	bs, err := WithCache(newTestMemBlobStore(t, "a"), CacheOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("with cache error: %v", err)
+	}
+	readString(t, bs, "a")
+	c := bs.(*cacheBlobStore).cache
+	// a read finding an older version gone does not drop the newer one
+	c.invalidateEntry(&cacheEntry{object: c.object("a"), version: "older"})
+	if stats := bs.(CacheReporter).CacheStats(); stats.Objects != 1 || stats.Invalidations != 0 {
+		t.Fatalf("stats after invalidating another version: %+v", stats)
+	}
+}
@@ -0,0 +1,222 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type ChecksumAlgorithm string
+
+const (
+	ChecksumMD5    ChecksumAlgorithm = "md5"
+	ChecksumCRC32C ChecksumAlgorithm = "crc32c"
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+)
+
+// ErrChecksumMismatch matches every *ChecksumMismatchError with errors.Is
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumMismatchError the bytes stored at Path are not the bytes that were sent
+type ChecksumMismatchError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s: checksum mismatch, expected %s, actual %s", e.Path, e.Expected, e.Actual)
+}
+
+func (e *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+func newChecksumHash(algorithm ChecksumAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("%w: checksum algorithm %q", ErrUnsupported, algorithm)
+}
+
+// formatChecksum uses base64 for the value, the encoding s3 uses in its checksum headers
+func formatChecksum(algorithm ChecksumAlgorithm, sum []byte) string {
+	return string(algorithm) + ":" + base64.StdEncoding.EncodeToString(sum)
+}
+
+func parseChecksum(checksum string) (ChecksumAlgorithm, string, error) {
+	idx := strings.Index(checksum, ":")
+	if idx == -1 {
+		return "", "", fmt.Errorf("invalid checksum %q", checksum)
+	}
+	return ChecksumAlgorithm(checksum[:idx]), checksum[idx+1:], nil
+}
+
+// knownChecksum the checksum of meta computed with algorithm, empty if the store did not provide it.
+// A plain md5 etag (single part uploads, mem objects) counts as md5 checksum.
+func knownChecksum(meta *BlobMeta, algorithm ChecksumAlgorithm) string {
+	if strings.HasPrefix(meta.Checksum, string(algorithm)+":") {
+		return meta.Checksum
+	}
+	if algorithm == ChecksumMD5 && len(meta.ETag) == 2*md5.Size {
+		if sum, err := hex.DecodeString(meta.ETag); err == nil {
+			return formatChecksum(ChecksumMD5, sum)
+		}
+	}
+	return ""
+}
+
+// checksumReader computes the checksum of everything read through it
+type checksumReader struct {
+	r         io.Reader
+	algorithm ChecksumAlgorithm
+	hash      hash.Hash
+}
+
+func newChecksumReader(r io.Reader, algorithm ChecksumAlgorithm) (*checksumReader, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumReader{r: r, algorithm: algorithm, hash: h}, nil
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+func (r *checksumReader) Checksum() string {
+	return formatChecksum(r.algorithm, r.hash.Sum(nil))
+}
+
+// checksumVerifier hashes what is read through it with the algorithm of expected,
+// check reports a mismatch once everything was read
+type checksumVerifier struct {
+	path     string
+	expected string
+	*checksumReader
+}
+
+func newChecksumVerifier(path string, in io.Reader, expected string) (*checksumVerifier, error) {
+	algorithm, _, err := parseChecksum(expected)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newChecksumReader(in, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumVerifier{path: path, expected: expected, checksumReader: r}, nil
+}
+
+func (v *checksumVerifier) check() error {
+	if actual := v.Checksum(); actual != v.expected {
+		return &ChecksumMismatchError{Path: v.path, Expected: v.expected, Actual: actual}
+	}
+	return nil
+}
+
+// CopyOptions of CopyRawWithOptions
+type CopyOptions struct {
+	// Checksum verifies the copy end to end with the algorithm, empty disables the verification
+	Checksum ChecksumAlgorithm
+}
+
+// CopyRawWithOptions with Checksum set, the source is hashed while streaming and the checksum is
+// sent along when the source store already knows it, the destination then rejects corrupted bytes
+// itself and nothing more is read. Otherwise the checksum is only known once the source was streamed,
+// too late to be sent with the write, so the destination is compared against it using the checksum
+// the destination reports or, if it reports none, by reading it back. A difference returns a
+// *ChecksumMismatchError.
+func CopyRawWithOptions(ctx context.Context, sourceBS, destBS BlobStore, sourcePath, destPath string, opts CopyOptions) error {
+	if opts.Checksum == "" {
+		return CopyRawWithContext(ctx, sourceBS, destBS, sourcePath, destPath)
+	}
+	if sourceBS == nil {
+		return errors.New("source blobstore is required")
+	}
+	if destBS == nil {
+		destBS = sourceBS
+	}
+	source, dest := WithContext(sourceBS), WithContext(destBS)
+	sourceMeta, err := source.GetMetaWithContext(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	expected := knownChecksum(sourceMeta, opts.Checksum)
+
+	stream, err := source.ReadRawWithContext(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	in, err := newChecksumReader(stream, opts.Checksum)
+	if err != nil {
+		return err
+	}
+	// verified the destination checked the bytes it stored against expected
+	verified := false
+	if _, ok := destBS.(OptionsWriter); ok && expected != "" {
+		err = WriteRawWithOptions(destBS, destPath, newContextReader(ctx, in), WriteOptions{Checksum: expected})
+		verified = true
+	} else {
+		err = dest.WriteRawWithContext(ctx, destPath, in)
+	}
+	if err != nil {
+		return err
+	}
+	actual := in.Checksum()
+	if expected != "" && actual != expected {
+		return &ChecksumMismatchError{Path: sourcePath, Expected: expected, Actual: actual}
+	}
+	if verified {
+		return nil
+	}
+
+	destMeta, err := dest.GetMetaWithContext(ctx, destPath)
+	if err != nil {
+		return err
+	}
+	stored := knownChecksum(destMeta, opts.Checksum)
+	if stored == "" {
+		if stored, err = readChecksum(ctx, dest, destPath, opts.Checksum); err != nil {
+			return err
+		}
+	}
+	if stored != actual {
+		return &ChecksumMismatchError{Path: destPath, Expected: actual, Actual: stored}
+	}
+	return nil
+}
+
+func readChecksum(ctx context.Context, bs ContextBlobStore, path string, algorithm ChecksumAlgorithm) (string, error) {
+	rc, err := bs.ReadRawWithContext(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	r, err := newChecksumReader(rc, algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(ioutil.Discard, r); err != nil {
+		return "", err
+	}
+	return r.Checksum(), nil
+}
@@ -0,0 +1,96 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// corruptBlobStore flips the first byte of every write
+type corruptBlobStore struct {
+	BlobStore
+}
+
+func (c corruptBlobStore) WriteRaw(path string, in io.Reader) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		data[0] ^= 0xff
+	}
+	return c.BlobStore.WriteRaw(path, strings.NewReader(string(data)))
+}
+
+func TestCopyRawWithChecksum(t *testing.T) {
+	content := "hello world"
+	sourcePath, destPath := "my-bucket/checksum-src", "my-bucket/checksum-dst"
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		if err := bsSet[backend].WriteRaw(sourcePath, strings.NewReader(content)); err != nil {
+			t.Fatalf("write raw error: %v", err)
+		}
+		defer bsSet[backend].DeleteRaw(sourcePath)
+	}
+
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumMD5, ChecksumCRC32C, ChecksumSHA256} {
+		for _, pair := range [][2]string{{BlobStoreLocal, BlobStoreMem}, {BlobStoreMem, BlobStoreLocal}, {BlobStoreMem, BlobStoreMem}} {
+			source, dest := bsSet[pair[0]], bsSet[pair[1]]
+			t.Run(string(algorithm)+" "+pair[0]+" to "+pair[1], func(t *testing.T) {
+				err := CopyRawWithOptions(context.Background(), source, dest, sourcePath, destPath, CopyOptions{Checksum: algorithm})
+				if err != nil {
+					t.Fatalf("copy raw error: %v", err)
+				}
+				defer dest.DeleteRaw(destPath)
+
+				err = CopyRawWithOptions(context.Background(), source, corruptBlobStore{dest}, sourcePath, destPath, CopyOptions{Checksum: algorithm})
+				var mismatch *ChecksumMismatchError
+				if !errors.As(err, &mismatch) || mismatch.Path != destPath {
+					t.Fatalf("copy to corrupting store: %v, want checksum mismatch of %s", err, destPath)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyRawWithChecksumVerifiedOnWrite(t *testing.T) {
+	local, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	registry := NewMetricsRegistry()
+	dest := WithMetrics(local, "local", registry)
+	// the md5 etag of the mem store is sent with the write, the destination is not read back
+	err = CopyRawWithOptions(context.Background(), newTestMemBlobStore(t, "a"), dest, "a", "b", CopyOptions{Checksum: ChecksumMD5})
+	if err != nil {
+		t.Fatalf("copy raw error: %v", err)
+	}
+	for _, m := range registry.Snapshot() {
+		if m.Op == opReadRaw || m.Op == opGetMeta {
+			t.Fatalf("destination checked after a verified write: %+v", m)
+		}
+	}
+	if got := readString(t, local, "b"); got != "a" {
+		t.Fatalf("copied content: %q", got)
+	}
+}
+
+func TestWriteRawWithWrongChecksum(t *testing.T) {
+	path := "my-bucket/checksum-wrong"
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := bsSet[backend]
+		t.Run(backend, func(t *testing.T) {
+			err := WriteRawWithOptions(bs, path, strings.NewReader("hello world"), WriteOptions{
+				Checksum: formatChecksum(ChecksumSHA256, make([]byte, 32)),
+			})
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("write with wrong checksum: %v, want %v", err, ErrChecksumMismatch)
+			}
+			if _, err = bs.GetMeta(path); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("corrupted object should not be kept: %v", err)
+			}
+		})
+	}
+}
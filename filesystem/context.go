@@ -0,0 +1,168 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// WithContext returns bs as a ContextBlobStore. Stores that are not context-aware are wrapped,
+// ctx is then checked before each call and while streaming.
+func WithContext(bs BlobStore) ContextBlobStore {
+	if cbs, ok := bs.(ContextBlobStore); ok {
+		return cbs
+	}
+	return &contextAdapter{bs: bs}
+}
+
+// WithoutContext returns cbs as a BlobStore, all calls use context.Background()
+func WithoutContext(cbs ContextBlobStore) BlobStore {
+	if bs, ok := cbs.(BlobStore); ok {
+		return bs
+	}
+	return &backgroundAdapter{cbs: cbs}
+}
+
+type contextAdapter struct {
+	bs BlobStore
+}
+
+var _ ContextBlobStore = &contextAdapter{}
+
+func (a *contextAdapter) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.bs.ListMeta(path, option)
+}
+
+func (a *contextAdapter) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.bs.GetMeta(path)
+}
+
+func (a *contextAdapter) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := a.bs.ReadRaw(path)
+	if err != nil {
+		return nil, err
+	}
+	return newContextReadCloser(ctx, rc), nil
+}
+
+func (a *contextAdapter) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.bs.WriteRaw(path, newContextReader(ctx, in))
+}
+
+func (a *contextAdapter) DeleteRawWithContext(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.bs.DeleteRaw(path)
+}
+
+func (a *contextAdapter) GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return a.bs.GetSignedURL(path, expire)
+}
+
+func (a *contextAdapter) BuildURL(path string) (string, error) {
+	return a.bs.BuildURL(path)
+}
+
+type backgroundAdapter struct {
+	cbs ContextBlobStore
+}
+
+var _ BlobStore = &backgroundAdapter{}
+
+func (a *backgroundAdapter) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return a.cbs.ListMetaWithContext(context.Background(), path, option)
+}
+
+func (a *backgroundAdapter) GetMeta(path string) (*BlobMeta, error) {
+	return a.cbs.GetMetaWithContext(context.Background(), path)
+}
+
+func (a *backgroundAdapter) ReadRaw(path string) (io.ReadCloser, error) {
+	return a.cbs.ReadRawWithContext(context.Background(), path)
+}
+
+func (a *backgroundAdapter) WriteRaw(path string, in io.Reader) error {
+	return a.cbs.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (a *backgroundAdapter) DeleteRaw(path string) error {
+	return a.cbs.DeleteRawWithContext(context.Background(), path)
+}
+
+func (a *backgroundAdapter) GetSignedURL(path string, expire time.Duration) (string, error) {
+	return a.cbs.GetSignedURLWithContext(context.Background(), path, expire)
+}
+
+func (a *backgroundAdapter) BuildURL(path string) (string, error) {
+	return a.cbs.BuildURL(path)
+}
+
+// contextReader fails the next Read once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closerFunc adapts a function to io.Closer
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func newContextReadCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if ctx.Done() == nil {
+		return rc
+	}
+	return &readCloser{Reader: &contextReader{ctx: ctx, r: rc}, Closer: rc}
+}
+
+// sleepContext waits for d, it returns ctx.Err() if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
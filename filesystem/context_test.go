@@ -0,0 +1,65 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLocalContextCanceled(t *testing.T) {
+	bs := bsSet[BlobStoreLocal].(ContextBlobStore)
+	content := "hello world"
+	path := "my-bucket/ctx-hello"
+	if err := bs.WriteRawWithContext(context.Background(), path, strings.NewReader(content)); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer bs.DeleteRawWithContext(context.Background(), path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out, err := bs.ReadRawWithContext(ctx, path)
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	defer out.Close()
+	cancel()
+	if _, err = ioutil.ReadAll(out); !errors.Is(err, context.Canceled) {
+		t.Fatalf("read after cancel: %v, want %v", err, context.Canceled)
+	}
+
+	if _, err = bs.ListMetaWithContext(ctx, "my-bucket", ListMetaOption{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("list meta after cancel: %v, want %v", err, context.Canceled)
+	}
+	if err = bs.WriteRawWithContext(ctx, path, strings.NewReader(content)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("write raw after cancel: %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestContextAdapter(t *testing.T) {
+	local := bsSet[BlobStoreLocal]
+	// hide the context-aware methods of local to exercise the adapters
+	bs := WithContext(struct{ BlobStore }{local})
+	if _, ok := bs.(*contextAdapter); !ok {
+		t.Fatalf("want contextAdapter, got %T", bs)
+	}
+	path := "my-bucket/ctx-adapter"
+	plain := WithoutContext(bs)
+	if err := plain.WriteRaw(path, strings.NewReader("hello world")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer local.DeleteRaw(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bs.GetMetaWithContext(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Fatalf("get meta after cancel: %v, want %v", err, context.Canceled)
+	}
+	meta, err := plain.GetMeta(path)
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	if meta.Size != 11 {
+		t.Fatalf("size: %d, want 11", meta.Size)
+	}
+}
@@ -0,0 +1,19 @@
+package filesystem
+
+import (
+	"context"
+)
+
+// Copier is implemented by stores able to copy without streaming the bytes through the process,
+// CopyRaw uses it when the destination store implements it.
+type Copier interface {
+	// CopyRawFrom copies sourcePath of source to destPath of the receiver. It returns an error
+	// matching ErrUnsupported if source is not a store the receiver can copy from.
+	CopyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error
+}
+
+// copySourceChecker is implemented by the Copiers of the package, so wrappers can tell a source
+// the receiver cannot copy from before running the copy through their middleware
+type copySourceChecker interface {
+	canCopyFrom(source BlobStore) bool
+}
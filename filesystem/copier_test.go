@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCopyRawServerSide(t *testing.T) {
+	sourcePath, destPath := "my-bucket/copier-src", "my-bucket/copier/dst"
+	stores := newTestBlobStores(t)
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := stores[backend]
+		t.Run(backend, func(t *testing.T) {
+			err := WriteRawWithOptions(bs, sourcePath, strings.NewReader("hello world"), WriteOptions{
+				ContentType: "text/x-hello",
+				Metadata:    map[string]string{"owner": "team-a"},
+			})
+			if err != nil {
+				t.Fatalf("write raw error: %v", err)
+			}
+			defer bs.DeleteRaw(sourcePath)
+
+			if err = CopyRaw(bs, bs, sourcePath, destPath); err != nil {
+				t.Fatalf("copy raw error: %v", err)
+			}
+			defer bs.DeleteRaw(destPath)
+
+			out, err := bs.ReadRaw(destPath)
+			if err != nil {
+				t.Fatalf("read raw error: %v", err)
+			}
+			defer out.Close()
+			content, err := ioutil.ReadAll(out)
+			if err != nil || string(content) != "hello world" {
+				t.Fatalf("copied content: %q %v", content, err)
+			}
+			// only a server side copy keeps the options
+			meta, err := bs.GetMeta(destPath)
+			if err != nil {
+				t.Fatalf("get meta error: %v", err)
+			}
+			if meta.ContentType != "text/x-hello" || meta.Metadata["owner"] != "team-a" {
+				t.Fatalf("options were not copied: %+v", *meta)
+			}
+		})
+	}
+
+	local := stores[BlobStoreLocal].(Copier)
+	err := local.CopyRawFrom(context.Background(), stores[BlobStoreMem], sourcePath, destPath)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("copy from mem to local: %v, want %v", err, ErrUnsupported)
+	}
+
+	// a copy the store cannot do is not a failed call of the decorated store
+	registry := NewMetricsRegistry()
+	wrapped := WithMetrics(stores[BlobStoreLocal], "local", registry).(Copier)
+	err = wrapped.CopyRawFrom(context.Background(), stores[BlobStoreMem], sourcePath, destPath)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("copy from mem to wrapped local: %v, want %v", err, ErrUnsupported)
+	}
+	if snapshot := registry.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("unsupported copy was measured: %+v", snapshot)
+	}
+}
+
+func TestCopySourceOf(t *testing.T) {
+	if got := copySourceOf("my-bucket", "/dir/hello world+1"); got != "my-bucket//dir/hello%20world+1" {
+		t.Fatalf("copy source: %s", got)
+	}
+}
+
+func TestCopyPartSize(t *testing.T) {
+	testCases := []struct {
+		desc string
+		size int64
+		want int64
+	}{
+		{
+			desc: "just over the copy object limit",
+			size: MaxCopyObjectSize + 1,
+			want: minCopyPartSize,
+		},
+		{
+			desc: "5TiB",
+			size: 5 << 40,
+			want: (5<<40 + maxCopyParts - 1) / maxCopyParts,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := copyPartSize(tc.size)
+			if got != tc.want {
+				t.Fatalf("part size: %d, want: %d", got, tc.want)
+			}
+			if (tc.size+got-1)/got > maxCopyParts {
+				t.Fatalf("part size %d needs more than %d parts", got, maxCopyParts)
+			}
+		})
+	}
+}
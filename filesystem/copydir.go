@@ -0,0 +1,163 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCopyDirParallelism = 4
+
+// CopyDirOptions of CopyDir
+type CopyDirOptions struct {
+	// Parallelism number of files copied concurrently, default 4
+	Parallelism int
+	// Checksum verifies every copied file, see CopyOptions
+	Checksum ChecksumAlgorithm
+	// FailFast stops scheduling new copies after the first failed file
+	FailFast bool
+}
+
+// CopyDirStats counts the files copied by CopyDir
+type CopyDirStats struct {
+	Files    int64         `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Failed   int64         `json:"failed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// CopyFileError a file CopyDir failed to list or copy
+type CopyFileError struct {
+	SourcePath string
+	DestPath   string
+	Err        error
+}
+
+func (e *CopyFileError) Error() string {
+	return fmt.Sprintf("copy %s to %s: %v", e.SourcePath, e.DestPath, e.Err)
+}
+
+func (e *CopyFileError) Unwrap() error {
+	return e.Err
+}
+
+// CopyDirError collects the failed files of a CopyDir, the other files were copied
+type CopyDirError struct {
+	Errors []*CopyFileError
+}
+
+func (e *CopyDirError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d files failed, first: %v", len(e.Errors), e.Errors[0])
+}
+
+// CopyDir copies the files below sourcePrefix of sourceBS to destPrefix of destBS
+func CopyDir(sourceBS, destBS BlobStore, sourcePrefix, destPrefix string, opts CopyDirOptions) (*CopyDirStats, error) {
+	return CopyDirWithContext(context.Background(), sourceBS, destBS, sourcePrefix, destPrefix, opts)
+}
+
+// CopyDirWithContext copies every file below sourcePrefix to the same relative path below destPrefix.
+// The source is walked while copying, so the listing is never held in memory.
+// Prefixes are paths relative to the stores, not URIs.
+func CopyDirWithContext(ctx context.Context, sourceBS, destBS BlobStore, sourcePrefix, destPrefix string, opts CopyDirOptions) (*CopyDirStats, error) {
+	if destBS == nil {
+		destBS = sourceBS
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultCopyDirParallelism
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	stats := &CopyDirStats{}
+	var (
+		mu     sync.Mutex
+		failed []*CopyFileError
+		wg     sync.WaitGroup
+	)
+	fail := func(fileErr *CopyFileError) {
+		mu.Lock()
+		failed = append(failed, fileErr)
+		mu.Unlock()
+		atomic.AddInt64(&stats.Failed, 1)
+		if opts.FailFast {
+			cancel()
+		}
+	}
+
+	jobs := make(chan *BlobMeta, parallelism)
+	relPath := newRelPath(sourcePrefix)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for meta := range jobs {
+				if ctx.Err() != nil {
+					// drain the queued files once canceled
+					continue
+				}
+				rel := relPath(meta)
+				sourcePath, destPath := pathpkg.Join(sourcePrefix, rel), pathpkg.Join(destPrefix, rel)
+				err := CopyRawWithOptions(ctx, sourceBS, destBS, sourcePath, destPath, CopyOptions{Checksum: opts.Checksum})
+				if err != nil {
+					fail(&CopyFileError{SourcePath: sourcePath, DestPath: destPath, Err: err})
+					continue
+				}
+				atomic.AddInt64(&stats.Files, 1)
+				atomic.AddInt64(&stats.Bytes, meta.Size)
+			}
+		}()
+	}
+
+	walkErr := Walk(sourceBS, sourcePrefix, func(meta *BlobMeta, isDir bool, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			rel := relPath(meta)
+			fail(&CopyFileError{SourcePath: pathpkg.Join(sourcePrefix, rel), DestPath: pathpkg.Join(destPrefix, rel), Err: err})
+			return nil
+		}
+		if isDir {
+			return nil
+		}
+		select {
+		case jobs <- meta:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wg.Wait()
+	stats.Duration = time.Since(start)
+
+	if len(failed) > 0 {
+		return stats, &CopyDirError{Errors: failed}
+	}
+	if walkErr == nil {
+		walkErr = parent.Err()
+	}
+	return stats, walkErr
+}
+
+// newRelPath returns the path of a walked meta relative to the walked prefix
+func newRelPath(prefix string) func(meta *BlobMeta) string {
+	root := strings.Trim(pathpkg.Clean("/"+prefix), Delimiter)
+	return func(meta *BlobMeta) string {
+		name := strings.Trim(meta.Name, Delimiter)
+		if root == "" || name == root {
+			return strings.TrimPrefix(name, root)
+		}
+		return strings.TrimPrefix(name, root+Delimiter)
+	}
+}
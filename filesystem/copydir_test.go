@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// failingBlobStore fails writes to paths containing fail
+type failingBlobStore struct {
+	BlobStore
+	fail string
+}
+
+func (bs *failingBlobStore) WriteRaw(path string, in io.Reader) error {
+	if strings.Contains(path, bs.fail) {
+		return ErrPermission
+	}
+	return bs.BlobStore.WriteRaw(path, in)
+}
+
+func TestCopyDir(t *testing.T) {
+	files := []string{"a", "b/c", "b/d/e", "f/g"}
+	testCases := []struct {
+		desc   string
+		source string
+		dest   string
+	}{
+		{desc: "local to mem", source: BlobStoreLocal, dest: BlobStoreMem},
+		{desc: "mem to local", source: BlobStoreMem, dest: BlobStoreLocal},
+		{desc: "local to local", source: BlobStoreLocal, dest: BlobStoreLocal},
+		{desc: "mem to mem", source: BlobStoreMem, dest: BlobStoreMem},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sourceBS, destBS := bsSet[tc.source], bsSet[tc.dest]
+			var size int64
+			for _, name := range files {
+				if err := sourceBS.WriteRaw("my-bucket/copydir-src/"+name, strings.NewReader(name)); err != nil {
+					t.Fatalf("write raw error: %v", err)
+				}
+				defer sourceBS.DeleteRaw("my-bucket/copydir-src/" + name)
+				size += int64(len(name))
+			}
+
+			stats, err := CopyDir(sourceBS, destBS, "my-bucket/copydir-src", "my-bucket/copydir-dst", CopyDirOptions{
+				Parallelism: 2,
+				Checksum:    ChecksumMD5,
+			})
+			for _, name := range files {
+				defer destBS.DeleteRaw("my-bucket/copydir-dst/" + name)
+			}
+			if err != nil {
+				t.Fatalf("copy dir error: %v", err)
+			}
+			if stats.Files != int64(len(files)) || stats.Bytes != size || stats.Failed != 0 {
+				t.Fatalf("stats: %+v", *stats)
+			}
+			for _, name := range files {
+				out, err := destBS.ReadRaw("my-bucket/copydir-dst/" + name)
+				if err != nil {
+					t.Fatalf("read raw %s error: %v", name, err)
+				}
+				content, err := ioutil.ReadAll(out)
+				out.Close()
+				if err != nil || string(content) != name {
+					t.Fatalf("copied %s content: %q %v", name, content, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyDirErrors(t *testing.T) {
+	sourceBS := newTestMemBlobStore(t, "src/a", "src/bad/b", "src/c", "src/d")
+	destBS := &failingBlobStore{BlobStore: newTestMemBlobStore(t), fail: "bad"}
+
+	stats, err := CopyDir(sourceBS, destBS, "src", "dst", CopyDirOptions{})
+	var dirErr *CopyDirError
+	if !errors.As(err, &dirErr) || len(dirErr.Errors) != 1 {
+		t.Fatalf("copy dir error: %v, want one failed file", err)
+	}
+	fileErr := dirErr.Errors[0]
+	if fileErr.SourcePath != "src/bad/b" || fileErr.DestPath != "dst/bad/b" || !errors.Is(fileErr, ErrPermission) {
+		t.Fatalf("file error: %+v", *fileErr)
+	}
+	if stats.Files != 3 || stats.Failed != 1 {
+		t.Fatalf("stats: %+v", *stats)
+	}
+	if _, err = destBS.GetMeta("dst/d"); err != nil {
+		t.Fatalf("files after the failure were not copied: %v", err)
+	}
+
+	stats, err = CopyDir(sourceBS, destBS, "src", "dst2", CopyDirOptions{Parallelism: 1, FailFast: true})
+	if err == nil || stats.Files != 1 || stats.Failed != 1 {
+		t.Fatalf("fail fast: %v %+v", err, *stats)
+	}
+}
@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+)
+
+// ParallelDownloader is implemented by stores reading an object with concurrent ranged reads
+type ParallelDownloader interface {
+	// DownloadAt writes path into w at the offsets of the object and returns the bytes written
+	DownloadAt(ctx context.Context, path string, w io.WriterAt) (int64, error)
+	// DownloadStream reassembles the ranges into an ordered stream
+	DownloadStream(ctx context.Context, path string) (io.ReadCloser, error)
+	// ParallelDownloadThreshold objects of at least this size are copied to local stores with DownloadAt
+	ParallelDownloadThreshold() int64
+}
+
+// DownloadAt uses the parallel download of bs, other stores are streamed into w
+func DownloadAt(ctx context.Context, bs BlobStore, path string, w io.WriterAt) (int64, error) {
+	if d, ok := bs.(ParallelDownloader); ok {
+		return d.DownloadAt(ctx, path, w)
+	}
+	stream, err := WithContext(bs).ReadRawWithContext(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	return io.Copy(&offsetWriter{w: w}, stream)
+}
+
+// DownloadStream uses the parallel download of bs, other stores fall back to ReadRaw
+func DownloadStream(ctx context.Context, bs BlobStore, path string) (io.ReadCloser, error) {
+	if d, ok := bs.(ParallelDownloader); ok {
+		return d.DownloadStream(ctx, path)
+	}
+	return WithContext(bs).ReadRawWithContext(ctx, path)
+}
+
+// offsetWriter writes sequentially into an io.WriterAt
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
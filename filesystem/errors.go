@@ -0,0 +1,88 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// Errors returned by every BlobStore, test them with errors.Is
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrIsDir         = errors.New("is a directory")
+	ErrNotDir        = errors.New("not a directory")
+	ErrInvalidPath   = errors.New("invalid path")
+	ErrUnsupported   = errors.New("unsupported operation")
+	ErrPermission    = errors.New("permission denied")
+	ErrThrottled     = errors.New("throttled")
+)
+
+// BlobError records a failed BlobStore operation.
+// errors.Is matches Kind as well as everything wrapped by Cause, so both
+// errors.Is(err, ErrNotFound) and errors.Is(err, fs.ErrNotExist) hold for a missing local file.
+type BlobError struct {
+	Op   string
+	Path string
+	// Kind one of the Err* sentinels, nil if the backend error is not classified
+	Kind error
+	// Cause the backend error, nil if the failure was detected by the store itself
+	Cause error
+}
+
+func (e *BlobError) Error() string {
+	msg := e.Op + " " + e.Path + ": "
+	if e.Cause != nil {
+		return msg + e.Cause.Error()
+	}
+	if e.Kind != nil {
+		return msg + e.Kind.Error()
+	}
+	return msg + "unknown error"
+}
+
+func (e *BlobError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *BlobError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// newBlobError wraps a backend error, classifying it by the os and syscall errors it wraps
+func newBlobError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var blobErr *BlobError
+	if errors.As(err, &blobErr) {
+		return err
+	}
+	return &BlobError{Op: op, Path: path, Kind: classifyError(err), Cause: err}
+}
+
+var blobErrorKinds = []error{
+	ErrNotFound, ErrAlreadyExists, ErrIsDir, ErrNotDir, ErrInvalidPath, ErrUnsupported, ErrPermission, ErrThrottled,
+	ErrChecksumMismatch,
+}
+
+func classifyError(err error) error {
+	for _, kind := range blobErrorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		return ErrAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	case errors.Is(err, syscall.EISDIR):
+		return ErrIsDir
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDir
+	}
+	return nil
+}
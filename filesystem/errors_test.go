@@ -0,0 +1,166 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestBlobErrorKinds(t *testing.T) {
+	local := bsSet[BlobStoreLocal]
+	basePath := local.(*localBlobStore).basePath
+	if err := local.WriteRaw("my-bucket/errors/hello", strings.NewReader("hello world")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer local.DeleteRaw("my-bucket/errors/hello")
+
+	testCases := []struct {
+		desc     string
+		call     func() error
+		wantKind error
+	}{
+		{
+			desc: "local get missing",
+			call: func() error {
+				_, err := local.GetMeta("my-bucket/errors/missing")
+				return err
+			},
+			wantKind: ErrNotFound,
+		},
+		{
+			desc: "local read missing",
+			call: func() error {
+				_, err := local.ReadRaw("my-bucket/errors/missing")
+				return err
+			},
+			wantKind: ErrNotFound,
+		},
+		{
+			desc: "local get meta of dir",
+			call: func() error {
+				_, err := local.GetMeta("my-bucket/errors")
+				return err
+			},
+			wantKind: ErrIsDir,
+		},
+		{
+			desc: "local list file",
+			call: func() error {
+				_, err := local.ListMeta("my-bucket/errors/hello", ListMetaOption{})
+				return err
+			},
+			wantKind: ErrNotDir,
+		},
+		{
+			desc: "local path escapes basePath",
+			call: func() error {
+				_, err := local.GetMeta("file:///" + filepath.Dir(basePath) + "/hello")
+				return err
+			},
+			wantKind: ErrInvalidPath,
+		},
+		{
+			desc: "local wrong scheme",
+			call: func() error {
+				_, err := local.GetMeta("s3://my-bucket/hello")
+				return err
+			},
+			wantKind: ErrInvalidPath,
+		},
+		{
+			desc: "local copy from mem",
+			call: func() error {
+				return local.(Copier).CopyRawFrom(context.Background(), bsSet[BlobStoreMem], "hello", "my-bucket/errors/copy")
+			},
+			wantKind: ErrUnsupported,
+		},
+		{
+			desc: "mem get missing",
+			call: func() error {
+				_, err := bsSet[BlobStoreMem].GetMeta("missing")
+				return err
+			},
+			wantKind: ErrNotFound,
+		},
+		{
+			desc: "mem empty key",
+			call: func() error {
+				return bsSet[BlobStoreMem].WriteRaw("", strings.NewReader(""))
+			},
+			wantKind: ErrInvalidPath,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := tc.call()
+			if !errors.Is(err, tc.wantKind) {
+				t.Fatalf("error: %v, want kind: %v", err, tc.wantKind)
+			}
+			var blobErr *BlobError
+			if !errors.As(err, &blobErr) || blobErr.Op == "" {
+				t.Fatalf("error: %#v is not a BlobError", err)
+			}
+		})
+	}
+
+	_, err := local.GetMeta("my-bucket/errors/missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("error: %v should still match fs.ErrNotExist", err)
+	}
+}
+
+func TestClassifyS3Error(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		err      error
+		wantKind error
+	}{
+		{
+			desc:     "no such key",
+			err:      awserr.New(s3.ErrCodeNoSuchKey, "missing", nil),
+			wantKind: ErrNotFound,
+		},
+		{
+			desc:     "head object 404",
+			err:      awserr.NewRequestFailure(awserr.New("NotFound", "", nil), http.StatusNotFound, "id"),
+			wantKind: ErrNotFound,
+		},
+		{
+			desc:     "access denied",
+			err:      awserr.New("AccessDenied", "denied", nil),
+			wantKind: ErrPermission,
+		},
+		{
+			desc:     "slow down",
+			err:      awserr.New("SlowDown", "slow down", nil),
+			wantKind: ErrThrottled,
+		},
+		{
+			desc:     "unknown code with 503",
+			err:      awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "", nil), http.StatusServiceUnavailable, "id"),
+			wantKind: ErrThrottled,
+		},
+		{
+			desc:     "bucket exists",
+			err:      awserr.New(s3.ErrCodeBucketAlreadyOwnedByYou, "", nil),
+			wantKind: ErrAlreadyExists,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := newS3Error("GetMeta", "hello", tc.err)
+			if !errors.Is(err, tc.wantKind) {
+				t.Fatalf("error: %v, want kind: %v", err, tc.wantKind)
+			}
+		})
+	}
+}
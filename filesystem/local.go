@@ -1,6 +1,7 @@
 package filesystem
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,9 +17,24 @@ import (
 type localBlobStore struct {
 	config   map[string]string
 	basePath string
+	// realBasePath basePath with its symlinks resolved
+	realBasePath string
+	symlinks     SymlinkPolicy
+	// syncDir fsync the parent directory after a write, see ConfigSyncDir
+	syncDir bool
+	// signKey the HMAC key of signed URLs, see ConfigSignKey
+	signKey []byte
 }
 
-var _ BlobStore = &localBlobStore{}
+var (
+	_ BlobStore        = &localBlobStore{}
+	_ ContextBlobStore = &localBlobStore{}
+	_ Pager            = &localBlobStore{}
+	_ Walker           = &localBlobStore{}
+	_ ContextWalker    = &localBlobStore{}
+	_ RangeReader      = &localBlobStore{}
+	_ OptionsWriter    = &localBlobStore{}
+)
 
 func newLocalBlobStore(basePath string, config map[string]string) (*localBlobStore, error) {
 	info, err := os.Stat(basePath)
@@ -31,9 +48,32 @@ func newLocalBlobStore(basePath string, config map[string]string) (*localBlobSto
 	if err != nil {
 		return nil, fmt.Errorf("get absolute basePath error: %v", err)
 	}
+	realBasePath, err := filepath.EvalSymlinks(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve basePath error: %v", err)
+	}
+	symlinks, err := parseSymlinkPolicy(config[ConfigSymlinks])
+	if err != nil {
+		return nil, err
+	}
+	var syncDir bool
+	if v := config[ConfigSyncDir]; v != "" {
+		syncDir, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", ConfigSyncDir, v)
+		}
+	}
+	signKey, err := newSignKey(config)
+	if err != nil {
+		return nil, err
+	}
 	return &localBlobStore{
-		config:   config,
-		basePath: basePath,
+		config:       config,
+		basePath:     basePath,
+		realBasePath: realBasePath,
+		symlinks:     symlinks,
+		syncDir:      syncDir,
+		signKey:      signKey,
 	}, nil
 }
 
@@ -44,31 +84,43 @@ func newLocalBlobStore(basePath string, config map[string]string) (*localBlobSto
 func (f *localBlobStore) getFullPath(path string) (string, error) {
 	u, err := url.Parse(path)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: %v", ErrInvalidPath, err)
 	}
 
 	switch u.Scheme {
 	case "":
 		if !filepath.IsAbs(path) {
-			return filepath.Join(f.basePath, path), nil
+			path = filepath.Join(f.basePath, path)
 		}
 	case KindLocal:
-		path = filepath.Join(u.Host, u.Path)
-		if !filepath.IsAbs(path) {
-			path = "/" + path
+		if hasDotDot(u.Host) || hasDotDot(u.Path) {
+			return "", fmt.Errorf("%w: .. is not allowed in %s URIs", ErrInvalidPath, KindLocal)
 		}
+		path = filepath.Join("/", u.Host, u.Path)
 	default:
-		return "", errors.New("scheme should be empty or " + KindLocal)
+		return "", fmt.Errorf("%w: scheme should be empty or %s", ErrInvalidPath, KindLocal)
 	}
 
-	if !strings.HasPrefix(path, f.basePath) {
-		return "", errors.New("path " + path + " does not begin with basePath " + f.basePath)
+	path = filepath.Clean(path)
+	if !isSubPath(f.basePath, path) {
+		return "", fmt.Errorf("%w: path %s is outside basePath %s", ErrInvalidPath, path, f.basePath)
+	}
+	if err = f.checkSymlinks(path); err != nil {
+		return "", err
 	}
-
 	return path, nil
 }
 
 func (f *localBlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return f.ListMetaWithContext(context.Background(), path, option)
+}
+
+func (f *localBlobStore) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	metas, err := f.listMeta(ctx, path, option)
+	return metas, newBlobError("ListMeta", path, err)
+}
+
+func (f *localBlobStore) listMeta(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
 	fullPath, err := f.getFullPath(path)
 	if err != nil {
 		return nil, err
@@ -78,70 +130,242 @@ func (f *localBlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMe
 		return nil, err
 	}
 	if !info.IsDir() {
-		return nil, errors.New("list meta must operate a dir")
+		return nil, fmt.Errorf("%w: list meta must operate a dir", ErrNotDir)
 	}
 	metas := make([]*BlobMeta, 0)
 	if option.DirectoryOnly {
-		metas, err = addDirMetas(path, fullPath, metas)
+		metas, err = addDirMetas(ctx, path, fullPath, metas)
 		return metas, err
 	}
-	metas, err = addFileMetas(path, fullPath, metas)
+	err = walkDir(ctx, path, fullPath, func(meta *BlobMeta, isDir bool, err error) error {
+		if err != nil {
+			return err
+		}
+		if !isDir {
+			metas = append(metas, meta)
+		}
+		return nil
+	})
 	return metas, err
 }
 
 // addDirMetas 只加入fullPath这一级下的目录
-func addDirMetas(path, fullPath string, metas []*BlobMeta) ([]*BlobMeta, error) {
+func addDirMetas(ctx context.Context, path, fullPath string, metas []*BlobMeta) ([]*BlobMeta, error) {
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
 		return metas, err
 	}
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return metas, err
+		}
 		if entry.IsDir() {
 			info, err := entry.Info()
 			if err != nil {
 				return metas, err
 			}
-			metas = append(metas, &BlobMeta{
-				Name:         filepath.Join(path, info.Name()),
-				Size:         info.Size(),
-				URLPath:      filepath.Join(fullPath, info.Name()),
-				LastModified: info.ModTime(),
-			})
+			metas = append(metas, newLocalBlobMeta(filepath.Join(path, info.Name()), filepath.Join(fullPath, info.Name()), info))
 		}
 	}
 	return metas, nil
 }
 
-// addFileMetas 深度优先遍历加入所有文件，目录被丢弃
-func addFileMetas(path, fullPath string, metas []*BlobMeta) ([]*BlobMeta, error) {
+func (f *localBlobStore) Walk(path string, fn WalkFunc) error {
+	return f.walk(context.Background(), path, fn)
+}
+
+func (f *localBlobStore) WalkWithContext(ctx context.Context, path string, fn WalkFunc) error {
+	return f.walk(ctx, path, fn)
+}
+
+func (f *localBlobStore) walk(ctx context.Context, path string, fn WalkFunc) error {
+	fullPath, err := f.getFullPath(path)
+	if err != nil {
+		return newBlobError("Walk", path, err)
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return newBlobError("Walk", path, err)
+	}
+	if !info.IsDir() {
+		return newBlobError("Walk", path, fmt.Errorf("%w: walk must operate a dir", ErrNotDir))
+	}
+	err = walkDir(ctx, path, fullPath, func(meta *BlobMeta, isDir bool, err error) error {
+		return fn(meta, isDir, newBlobError("Walk", meta.Name, err))
+	})
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir 深度优先遍历, 目录先于其内容交给fn
+func walkDir(ctx context.Context, path, fullPath string, fn WalkFunc) error {
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
-		return metas, err
+		err = fn(&BlobMeta{Name: path, URLPath: fullPath}, true, err)
+		if err == SkipDir {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsDir() && (isLocalTempName(entry.Name()) || isLocalMetaName(entry.Name())) {
+			continue
+		}
+		name, entryPath := filepath.Join(path, entry.Name()), filepath.Join(fullPath, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			err = fn(&BlobMeta{Name: name, URLPath: entryPath}, entry.IsDir(), err)
+		} else {
+			err = fn(newLocalBlobMeta(name, entryPath, info), entry.IsDir(), nil)
+		}
+		if err == SkipDir {
+			if entry.IsDir() {
+				continue
+			}
+			// skip the remaining entries of this directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && info != nil {
+			if err = walkDir(ctx, name, entryPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newLocalBlobMeta(name, fullPath string, info os.FileInfo) *BlobMeta {
+	return &BlobMeta{
+		Name:         name,
+		Size:         info.Size(),
+		URLPath:      fullPath,
+		LastModified: info.ModTime(),
+		IsDir:        info.IsDir(),
+		ETag:         localETag(info),
+		Mode:         info.Mode(),
+	}
+}
+
+// localETag changes whenever the file is rewritten, it is not a content hash
+func localETag(info os.FileInfo) string {
+	return strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16)
+}
+
+func (f *localBlobStore) ListPage(path, cursor string, limit int64) (*MetaPage, error) {
+	page, err := f.listPage(path, cursor, limit)
+	return page, newBlobError("ListPage", path, err)
+}
+
+// listPage the cursor is the path of the last returned file relative to path,
+// files are visited in the same depth-first order as addFileMetas
+func (f *localBlobStore) listPage(path, cursor string, limit int64) (*MetaPage, error) {
+	fullPath, err := f.getFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: list page must operate a dir", ErrNotDir)
+	}
+	var after []string
+	if cursor != "" {
+		rel, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = strings.Split(rel, "/")
+	}
+	w := &localPageWalker{limit: pageLimit(limit), page: &MetaPage{Metas: make([]*BlobMeta, 0)}}
+	err = w.walk(path, fullPath, "", after)
+	if err == errPageFull {
+		w.page.IsTruncated = true
+		w.page.NextCursor = encodeCursor(w.last)
+		err = nil
+	}
+	return w.page, err
+}
+
+var errPageFull = errors.New("page full")
+
+type localPageWalker struct {
+	limit int64
+	page  *MetaPage
+	// last relative path of the last added file
+	last string
+}
+
+// walk skips everything up to and including after, the path components of the previous page's last file
+func (w *localPageWalker) walk(path, fullPath, rel string, after []string) error {
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return err
 	}
 	for _, entry := range entries {
+		var subAfter []string
+		if len(after) > 0 {
+			if entry.Name() < after[0] {
+				continue
+			}
+			if entry.Name() == after[0] {
+				if !entry.IsDir() || len(after) == 1 {
+					after = nil
+					continue
+				}
+				subAfter = after[1:]
+			}
+			after = nil
+		}
+		entryRel := entry.Name()
+		if rel != "" {
+			entryRel = rel + "/" + entry.Name()
+		}
+		if !entry.IsDir() && (isLocalTempName(entry.Name()) || isLocalMetaName(entry.Name())) {
+			continue
+		}
 		if entry.IsDir() {
-			// recursive add files below directories, but do not add directories
-			metas, err = addFileMetas(filepath.Join(path, entry.Name()), filepath.Join(fullPath, entry.Name()), metas)
+			err = w.walk(filepath.Join(path, entry.Name()), filepath.Join(fullPath, entry.Name()), entryRel, subAfter)
 			if err != nil {
-				return metas, err
+				return err
 			}
 			continue
 		}
+		if int64(len(w.page.Metas)) >= w.limit {
+			return errPageFull
+		}
 		info, err := entry.Info()
 		if err != nil {
-			return metas, err
+			return err
 		}
-		metas = append(metas, &BlobMeta{
-			Name:         filepath.Join(path, info.Name()),
-			Size:         info.Size(),
-			URLPath:      filepath.Join(fullPath, info.Name()),
-			LastModified: info.ModTime(),
-		})
+		w.page.Metas = append(w.page.Metas, newLocalBlobMeta(filepath.Join(path, info.Name()), filepath.Join(fullPath, info.Name()), info))
+		w.last = entryRel
 	}
-	return metas, nil
+	return nil
 }
 
 func (f *localBlobStore) GetMeta(path string) (*BlobMeta, error) {
+	return f.GetMetaWithContext(context.Background(), path)
+}
+
+func (f *localBlobStore) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	meta, err := f.getMeta(ctx, path)
+	return meta, newBlobError("GetMeta", path, err)
+}
+
+func (f *localBlobStore) getMeta(ctx context.Context, path string) (*BlobMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	fullPath, err := f.getFullPath(path)
 	if err != nil {
 		return nil, err
@@ -151,22 +375,38 @@ func (f *localBlobStore) GetMeta(path string) (*BlobMeta, error) {
 		return nil, err
 	}
 	if info.IsDir() {
-		return nil, errors.New("cannot get meta from a dir")
+		return nil, fmt.Errorf("%w: cannot get meta from a dir", ErrIsDir)
 	}
-	contentType, err := getFileContentType(fullPath)
+	opts, err := getLocalWriteOptions(fullPath)
 	if err != nil {
 		return nil, err
 	}
-	return &BlobMeta{
-		Name:         path,
-		ContentType:  contentType,
-		Size:         info.Size(),
-		URLPath:      fullPath,
-		LastModified: info.ModTime(),
-	}, nil
+	meta := newLocalBlobMeta(path, fullPath, info)
+	if opts != nil {
+		opts.apply(meta)
+	}
+	if meta.ContentType == "" {
+		meta.ContentType, err = getFileContentType(fullPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
 }
 
 func (f *localBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	return f.ReadRawWithContext(context.Background(), path)
+}
+
+func (f *localBlobStore) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := f.readRaw(ctx, path)
+	return rc, newBlobError("ReadRaw", path, err)
+}
+
+func (f *localBlobStore) readRaw(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	fullPath, err := f.getFullPath(path)
 	if err != nil {
 		return nil, err
@@ -175,33 +415,106 @@ func (f *localBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	return readout, nil
+	return newContextReadCloser(ctx, readout), nil
+}
+
+func (f *localBlobStore) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := f.readRange(path, offset, length)
+	return rc, newBlobError("ReadRange", path, err)
+}
+
+func (f *localBlobStore) readRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, errNegativeOffset
+	}
+	fullPath, err := f.getFullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return limitReadCloser(file, length), nil
 }
 
 func (f *localBlobStore) WriteRaw(path string, in io.Reader) error {
+	return f.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (f *localBlobStore) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	return newBlobError("WriteRaw", path, f.writeRaw(ctx, path, in, nil))
+}
+
+// WriteRawWithOptions the options are kept in an extended attribute of the file,
+// or in a hidden sidecar file where the filesystem has no user xattrs
+func (f *localBlobStore) WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error {
+	return newBlobError("WriteRawWithOptions", path, f.writeRaw(context.Background(), path, in, &opts))
+}
+
+// writeRaw opts nil removes the options stored by a previous write
+func (f *localBlobStore) writeRaw(ctx context.Context, path string, in io.Reader, opts *WriteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	fullPath, err := f.getFullPath(path)
 	if err != nil {
 		return err
 	}
-	err = os.MkdirAll(filepath.Dir(fullPath), 0777)
+	file, err := createAtomicFile(fullPath, 0666, f.syncDir)
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(fullPath)
+	defer file.abort()
+	// an overwrite keeps the mode of the replaced file, as os.Create did
+	if info, err := os.Stat(fullPath); err == nil {
+		if err = file.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	var verifier *checksumVerifier
+	if opts != nil && opts.Checksum != "" {
+		if verifier, err = newChecksumVerifier(path, in, opts.Checksum); err != nil {
+			return err
+		}
+		in = verifier
+	}
+	_, err = io.Copy(file, newContextReader(ctx, in))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = io.Copy(file, in)
-	return err
+	if verifier != nil {
+		if err = verifier.check(); err != nil {
+			return err
+		}
+	}
+	return commitLocalFile(file, opts)
 }
 
 func (f *localBlobStore) DeleteRaw(path string) error {
+	return f.DeleteRawWithContext(context.Background(), path)
+}
+
+func (f *localBlobStore) DeleteRawWithContext(ctx context.Context, path string) error {
+	return newBlobError("DeleteRaw", path, f.deleteRaw(ctx, path))
+}
+
+func (f *localBlobStore) deleteRaw(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	fullPath, err := f.getFullPath(path)
 	if err != nil {
 		return err
 	}
-	return os.Remove(fullPath)
+	if err = os.Remove(fullPath); err != nil {
+		return err
+	}
+	return removeLocalMeta(fullPath)
 }
 
 func getFileContentType(path string) (string, error) {
@@ -213,6 +526,10 @@ func getFileContentType(path string) (string, error) {
 
 	buffer := make([]byte, 512)
 	_, err = f.Read(buffer)
+	if err == io.EOF {
+		// an empty file
+		return http.DetectContentType(nil), nil
+	}
 	if err != nil {
 		return "", err
 	}
@@ -221,7 +538,12 @@ func getFileContentType(path string) (string, error) {
 }
 
 func (f *localBlobStore) GetSignedURL(path string, expire time.Duration) (string, error) {
-	return "", errors.New("local blob store do not support GetSignedURL")
+	return f.GetSignedURLWithContext(context.Background(), path, expire)
+}
+
+func (f *localBlobStore) GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error) {
+	signed, err := f.getSignedURL(ctx, path, expire)
+	return signed, newBlobError("GetSignedURL", path, err)
 }
 
 func (f *localBlobStore) BuildURL(path string) (string, error) {
@@ -0,0 +1,116 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigSyncDir "true" fsyncs the parent directory after a file is renamed into place,
+// so the new name survives a crash too
+const ConfigSyncDir = "syncDir"
+
+// the temp file of path is "." + base + localTempMarker + localTempSuffixLen random hex digits
+const (
+	localTempMarker    = ".tmp-"
+	localTempSuffixLen = 16
+)
+
+// atomicFile a temp file next to path, nothing is visible at path before commit.
+// Concurrent writers each get their own temp file, the last commit wins.
+type atomicFile struct {
+	*os.File
+	path    string
+	syncDir bool
+	done    bool
+}
+
+// createAtomicFile creates the temp file with perm, the umask applies as it does for os.Create
+func createAtomicFile(path string, perm os.FileMode, syncDir bool) (*atomicFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	prefix := filepath.Join(dir, "."+filepath.Base(path)+localTempMarker)
+	suffix := make([]byte, localTempSuffixLen/2)
+	for {
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		name := prefix + hex.EncodeToString(suffix)
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &atomicFile{File: file, path: path, syncDir: syncDir}, nil
+	}
+}
+
+// commit fsyncs and closes the temp file, then renames it to path
+func (f *atomicFile) commit() error {
+	if f.done {
+		return fmt.Errorf("%s already committed or aborted", f.Name())
+	}
+	f.done = true
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if f.syncDir {
+		return syncDir(filepath.Dir(f.path))
+	}
+	return nil
+}
+
+// abort drops the temp file, it is a no-op after commit so it can be deferred
+func (f *atomicFile) abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isLocalTempName reports whether name is a temp file of an unfinished write, listings skip them
+func isLocalTempName(name string) bool {
+	// at least one character of base between the dot and the marker
+	if len(name) < 2+len(localTempMarker)+localTempSuffixLen || name[0] != '.' {
+		return false
+	}
+	suffix := name[len(name)-localTempSuffixLen:]
+	if !strings.HasSuffix(name[:len(name)-localTempSuffixLen], localTempMarker) {
+		return false
+	}
+	for _, c := range suffix {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
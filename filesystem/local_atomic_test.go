@@ -0,0 +1,137 @@
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failAfterReader returns err after the content of r
+type failAfterReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *failAfterReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestLocalWriteAtomic(t *testing.T) {
+	bs, err := NewBlobStore(KindLocal, t.TempDir(), map[string]string{ConfigSyncDir: "true"})
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	if err = bs.WriteRaw("dir/file", strings.NewReader("old content")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+
+	readFile := func() string {
+		out, err := bs.ReadRaw("dir/file")
+		if err != nil {
+			t.Fatalf("read raw error: %v", err)
+		}
+		defer out.Close()
+		content, err := ioutil.ReadAll(out)
+		if err != nil {
+			t.Fatalf("read all error: %v", err)
+		}
+		return string(content)
+	}
+	assertNoTempFiles := func() {
+		entries, err := os.ReadDir(bs.(*localBlobStore).basePath + "/dir")
+		if err != nil {
+			t.Fatalf("read dir error: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("temp files left: %v", entries)
+		}
+	}
+
+	errRead := errors.New("read failed")
+	err = bs.WriteRaw("dir/file", &failAfterReader{r: strings.NewReader("new"), err: errRead})
+	if !errors.Is(err, errRead) {
+		t.Fatalf("write raw error: %v, want %v", err, errRead)
+	}
+	if got := readFile(); got != "old content" {
+		t.Fatalf("failed write replaced the file: %q", got)
+	}
+	assertNoTempFiles()
+
+	// concurrent writers never interleave, one of them wins as a whole
+	contents := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range contents {
+		contents[i] = string(bytes.Repeat([]byte{byte('a' + i)}, 1<<20))
+		wg.Add(1)
+		go func(content string) {
+			defer wg.Done()
+			if err := bs.WriteRaw("dir/file", strings.NewReader(content)); err != nil {
+				t.Errorf("concurrent write raw error: %v", err)
+			}
+		}(contents[i])
+	}
+	wg.Wait()
+	got := readFile()
+	found := false
+	for _, content := range contents {
+		found = found || got == content
+	}
+	if !found {
+		t.Fatalf("interleaved writes: %d bytes starting with %q", len(got), got[:1])
+	}
+	assertNoTempFiles()
+}
+
+func TestLocalTempFilesHidden(t *testing.T) {
+	bs, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	// the lookalikes of temp file names are real files
+	want := "dir/.config.tmp-old,dir/.x.tmp-0123456789ABCDEF,dir/file"
+	for _, name := range strings.Split(want, ",") {
+		if err = bs.WriteRaw(name, strings.NewReader("content")); err != nil {
+			t.Fatalf("write raw %s error: %v", name, err)
+		}
+	}
+	fullPath, err := bs.(*localBlobStore).getFullPath("dir/other")
+	if err != nil {
+		t.Fatalf("get full path error: %v", err)
+	}
+	file, err := createAtomicFile(fullPath, 0666, false)
+	if err != nil {
+		t.Fatalf("create atomic file error: %v", err)
+	}
+	defer file.abort()
+
+	metas, err := bs.ListMeta("dir", ListMetaOption{})
+	if err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if got := names(metas); got != want {
+		t.Fatalf("list meta: %s, want %s", got, want)
+	}
+	page, err := ListPage(bs, "dir", "", 10)
+	if err != nil {
+		t.Fatalf("list page error: %v", err)
+	}
+	if got := names(page.Metas); got != want {
+		t.Fatalf("list page: %s, want %s", got, want)
+	}
+}
+
+func TestLocalSyncDirConfig(t *testing.T) {
+	_, err := NewBlobStore(KindLocal, t.TempDir(), map[string]string{ConfigSyncDir: "sometimes"})
+	if err == nil {
+		t.Fatalf("invalid %s accepted", ConfigSyncDir)
+	}
+}
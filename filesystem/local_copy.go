@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	_ Copier            = &localBlobStore{}
+	_ copySourceChecker = &localBlobStore{}
+)
+
+// localStore is implemented by localBlobStore and the mount-backed stores embedding it
+type localStore interface {
+	local() *localBlobStore
+}
+
+func (f *localBlobStore) local() *localBlobStore {
+	return f
+}
+
+// CopyRawFrom copies between local stores with a reflink when the filesystem supports it,
+// falling back to copy_file_range, into a temp file renamed into place.
+// Large objects of a ParallelDownloader are downloaded into the temp file with concurrent ranged reads.
+func (f *localBlobStore) CopyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	return newBlobError("CopyRawFrom", destPath, f.copyRawFrom(ctx, source, sourcePath, destPath))
+}
+
+func (f *localBlobStore) canCopyFrom(source BlobStore) bool {
+	switch unwrapBlobStore(source).(type) {
+	case localStore, ParallelDownloader:
+		return true
+	}
+	return false
+}
+
+func (f *localBlobStore) copyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	src, ok := unwrapBlobStore(source).(localStore)
+	if !ok {
+		if downloader, ok := unwrapBlobStore(source).(ParallelDownloader); ok {
+			// through the decorators of source when they forward it
+			if d, ok := source.(ParallelDownloader); ok {
+				downloader = d
+			}
+			return f.downloadFrom(ctx, source, downloader, sourcePath, destPath)
+		}
+		return fmt.Errorf("%w: local copy from %T", ErrUnsupported, source)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srcFullPath, err := src.local().getFullPath(sourcePath)
+	if err != nil {
+		return err
+	}
+	fullPath, err := f.getFullPath(destPath)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(srcFullPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: cannot copy a dir", ErrIsDir)
+	}
+	opts, err := getLocalWriteOptions(srcFullPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := createAtomicFile(fullPath, 0666, f.syncDir)
+	if err != nil {
+		return err
+	}
+	defer out.abort()
+	if err = out.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = reflink(out.File, in); err != nil {
+		// *os.File.ReadFrom uses copy_file_range where available, only if in is the *os.File itself,
+		// so ctx is checked around the copy rather than while streaming
+		if _, err = io.Copy(out.File, in); err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return commitLocalFile(out, opts)
+}
+
+func (f *localBlobStore) downloadFrom(ctx context.Context, source BlobStore, downloader ParallelDownloader, sourcePath, destPath string) error {
+	meta, err := WithContext(source).GetMetaWithContext(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if meta.Size < downloader.ParallelDownloadThreshold() {
+		return fmt.Errorf("%w: %d bytes are below the parallel download threshold", ErrUnsupported, meta.Size)
+	}
+	fullPath, err := f.getFullPath(destPath)
+	if err != nil {
+		return err
+	}
+	out, err := createAtomicFile(fullPath, 0666, f.syncDir)
+	if err != nil {
+		return err
+	}
+	defer out.abort()
+	n, err := downloader.DownloadAt(ctx, sourcePath, out.File)
+	if err != nil {
+		return err
+	}
+	if n != meta.Size {
+		return fmt.Errorf("downloaded %d of %d bytes", n, meta.Size)
+	}
+	return commitLocalFile(out, nil)
+}
@@ -0,0 +1,18 @@
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone ioctl FICLONE from linux/fs.h
+const ficlone = 0x40049409
+
+// reflink shares the extents of src with dst on filesystems such as btrfs and xfs
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
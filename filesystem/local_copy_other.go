@@ -0,0 +1,12 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+)
+
+func reflink(dst, src *os.File) error {
+	return fmt.Errorf("%w: reflink is only supported on linux", ErrUnsupported)
+}
@@ -0,0 +1,87 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// localMetaSuffix the sidecar of a file holds its WriteOptions when the filesystem has no user xattrs,
+// it is named "." + the file name + localMetaSuffix and listings skip it
+const localMetaSuffix = ".blobstore-meta"
+
+// setXattr stubbed by the tests to exercise the sidecar
+var setXattr = setXattrWriteOptions
+
+func localMetaPath(fullPath string) string {
+	return filepath.Join(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+localMetaSuffix)
+}
+
+// isLocalMetaName reports whether name is the sidecar of a file, listings skip them
+func isLocalMetaName(name string) bool {
+	return len(name) > len(localMetaSuffix)+1 && strings.HasPrefix(name, ".") && strings.HasSuffix(name, localMetaSuffix)
+}
+
+// commitLocalFile commits file with opts, stored in an xattr of the temp file or else in the sidecar
+// of the file. The sidecar is written or removed once the file is committed, so a failed commit
+// keeps the options of the previous file. opts nil drops the options of a previous write.
+func commitLocalFile(file *atomicFile, opts *WriteOptions) error {
+	sidecar := false
+	if opts != nil {
+		err := setXattr(file.Name(), opts.normalize())
+		if err != nil && !errors.Is(err, syscall.ENOTSUP) && !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+		sidecar = err != nil
+	}
+	if err := file.commit(); err != nil {
+		return err
+	}
+	if !sidecar {
+		return removeLocalMeta(file.path)
+	}
+	data, err := json.Marshal(opts.normalize())
+	if err != nil {
+		return err
+	}
+	meta, err := createAtomicFile(localMetaPath(file.path), 0666, false)
+	if err != nil {
+		return err
+	}
+	defer meta.abort()
+	if _, err = meta.Write(data); err != nil {
+		return err
+	}
+	return meta.commit()
+}
+
+func removeLocalMeta(fullPath string) error {
+	if err := os.Remove(localMetaPath(fullPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// getLocalWriteOptions returns nil if the file was written without options
+func getLocalWriteOptions(fullPath string) (*WriteOptions, error) {
+	opts, err := getXattrWriteOptions(fullPath)
+	if err != nil || opts != nil {
+		return opts, err
+	}
+	data, err := ioutil.ReadFile(localMetaPath(fullPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	opts = &WriteOptions{}
+	if err = json.Unmarshal(data, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
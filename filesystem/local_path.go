@@ -0,0 +1,116 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigSymlinks the SymlinkPolicy of a local store, default SymlinkWithinBase
+const ConfigSymlinks = "symlinks"
+
+// SymlinkPolicy decides which symlinks below basePath a local store resolves
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow follows every symlink, wherever it points
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkWithinBase follows symlinks as long as the resolved path stays below basePath
+	SymlinkWithinBase SymlinkPolicy = "withinBase"
+	// SymlinkRefuse rejects every path going through a symlink
+	SymlinkRefuse SymlinkPolicy = "refuse"
+)
+
+func parseSymlinkPolicy(v string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(v); policy {
+	case "":
+		return SymlinkWithinBase, nil
+	case SymlinkFollow, SymlinkWithinBase, SymlinkRefuse:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid %s: %s, want one of %s, %s, %s", ConfigSymlinks, v, SymlinkFollow, SymlinkWithinBase, SymlinkRefuse)
+	}
+}
+
+// isSubPath reports whether path equals base or lives below it, compared by path component.
+// Both paths must be clean.
+func isSubPath(base, path string) bool {
+	if base == path {
+		return true
+	}
+	if !strings.HasSuffix(base, string(filepath.Separator)) {
+		base += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, base)
+}
+
+// hasDotDot reports whether the slash separated path has a ".." component
+func hasDotDot(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if name == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSymlinks applies the symlink policy to fullPath, a clean path below basePath.
+// The check and the following file operation are not atomic, a symlink swapped in between is not detected.
+func (f *localBlobStore) checkSymlinks(fullPath string) error {
+	switch f.symlinks {
+	case SymlinkFollow:
+		return nil
+	case SymlinkRefuse:
+		rel, err := filepath.Rel(f.basePath, fullPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		current := f.basePath
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			current = filepath.Join(current, name)
+			info, err := os.Lstat(current)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("%w: %s is a symlink", ErrInvalidPath, current)
+			}
+		}
+		return nil
+	default:
+		realPath, err := evalExistingSymlinks(fullPath)
+		if err != nil {
+			return err
+		}
+		if !isSubPath(f.realBasePath, realPath) {
+			return fmt.Errorf("%w: %s resolves to %s outside basePath %s", ErrInvalidPath, fullPath, realPath, f.basePath)
+		}
+		return nil
+	}
+}
+
+// evalExistingSymlinks resolves the longest existing prefix of path, the missing rest is appended as is
+func evalExistingSymlinks(path string) (string, error) {
+	suffix := ""
+	for {
+		realPath, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(realPath, suffix), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, suffix), nil
+		}
+		suffix = filepath.Join(filepath.Base(path), suffix)
+		path = parent
+	}
+}
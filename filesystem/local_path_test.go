@@ -0,0 +1,150 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLocalTree creates base with a dir, a file and symlinks pointing inside and outside of base
+func newTestLocalTree(t testing.TB) (base, outside string) {
+	root := t.TempDir()
+	base, outside = filepath.Join(root, "data"), filepath.Join(root, "data2")
+	for _, dir := range []string{filepath.Join(base, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+	}
+	for _, file := range []string{filepath.Join(base, "dir", "file"), filepath.Join(outside, "secret")} {
+		if err := os.WriteFile(file, []byte("content"), 0666); err != nil {
+			t.Fatalf("write file error: %v", err)
+		}
+	}
+	links := map[string]string{
+		"inside":   filepath.Join(base, "dir"),
+		"relative": "dir/file",
+		"outside":  outside,
+		"escape":   "../data2/secret",
+		"dangling": filepath.Join(outside, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, name)); err != nil {
+			t.Fatalf("symlink error: %v", err)
+		}
+	}
+	return base, outside
+}
+
+func TestLocalGetFullPath(t *testing.T) {
+	base, outside := newTestLocalTree(t)
+
+	testCases := []struct {
+		desc   string
+		path   string
+		policy SymlinkPolicy
+		want   string
+		// wantErr the path is rejected with ErrInvalidPath
+		wantErr bool
+	}{
+		{desc: "relative", path: "dir/file", want: base + "/dir/file"},
+		{desc: "relative missing", path: "dir/new/file", want: base + "/dir/new/file"},
+		{desc: "relative dot dot inside base", path: "dir/../dir/file", want: base + "/dir/file"},
+		{desc: "relative dot dot escape", path: "../data2/secret", wantErr: true},
+		{desc: "absolute", path: base + "/dir/file", want: base + "/dir/file"},
+		{desc: "absolute base", path: base, want: base},
+		{desc: "absolute sibling with base as prefix", path: outside + "/secret", wantErr: true},
+		{desc: "absolute dot dot escape", path: base + "/../data2/secret", wantErr: true},
+		{desc: "uri", path: "file://" + base + "/dir/file", want: base + "/dir/file"},
+		{desc: "uri dot dot", path: "file://" + base + "/dir/../dir/file", wantErr: true},
+		{desc: "uri escaped dot dot", path: "file://" + base + "/%2e%2e/data2/secret", wantErr: true},
+		{desc: "uri sibling", path: "file://" + outside + "/secret", wantErr: true},
+		{desc: "other scheme", path: "s3://bucket/dir/file", wantErr: true},
+		{desc: "symlink inside", path: "inside/file", want: base + "/inside/file"},
+		{desc: "symlink relative inside", path: "relative", want: base + "/relative"},
+		{desc: "symlink outside", path: "outside/secret", wantErr: true},
+		{desc: "symlink outside missing file", path: "outside/new", wantErr: true},
+		{desc: "symlink relative escape", path: "escape", wantErr: true},
+		{desc: "symlink dangling", path: "dangling", want: base + "/dangling"},
+		{desc: "follow symlink outside", path: "outside/secret", policy: SymlinkFollow, want: base + "/outside/secret"},
+		{desc: "follow still checks the lexical path", path: "../data2/secret", policy: SymlinkFollow, wantErr: true},
+		{desc: "refuse symlink inside", path: "inside/file", policy: SymlinkRefuse, wantErr: true},
+		{desc: "refuse symlink leaf", path: "relative", policy: SymlinkRefuse, wantErr: true},
+		{desc: "refuse plain path", path: "dir/file", policy: SymlinkRefuse, want: base + "/dir/file"},
+		{desc: "refuse missing path", path: "dir/new/file", policy: SymlinkRefuse, want: base + "/dir/new/file"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			bs, err := newLocalBlobStore(base, map[string]string{ConfigSymlinks: string(tc.policy)})
+			if err != nil {
+				t.Fatalf("new local blob store error: %v", err)
+			}
+			got, err := bs.getFullPath(tc.path)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("get full path %s: %s %v, want %v", tc.path, got, err, ErrInvalidPath)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("get full path %s: %s %v, want %s", tc.path, got, err, tc.want)
+			}
+		})
+	}
+
+	if _, err := newLocalBlobStore(base, map[string]string{ConfigSymlinks: "sometimes"}); err == nil {
+		t.Fatalf("invalid %s accepted", ConfigSymlinks)
+	}
+}
+
+func TestLocalSymlinkEscapeRead(t *testing.T) {
+	base, _ := newTestLocalTree(t)
+	bs, err := NewBlobStore(KindLocal, base, nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	if _, err = bs.ReadRaw("outside/secret"); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("read through symlink: %v, want %v", err, ErrInvalidPath)
+	}
+	if err = bs.WriteRaw("outside/new", strings.NewReader("content")); !errors.Is(err, ErrInvalidPath) {
+		t.Fatalf("write through symlink: %v, want %v", err, ErrInvalidPath)
+	}
+}
+
+func FuzzLocalGetFullPath(f *testing.F) {
+	base, _ := newTestLocalTree(f)
+	stores := make([]*localBlobStore, 0, 3)
+	for _, policy := range []SymlinkPolicy{SymlinkFollow, SymlinkWithinBase, SymlinkRefuse} {
+		bs, err := newLocalBlobStore(base, map[string]string{ConfigSymlinks: string(policy)})
+		if err != nil {
+			f.Fatalf("new local blob store error: %v", err)
+		}
+		stores = append(stores, bs)
+	}
+	for _, seed := range []string{
+		"dir/file", "../data2/secret", "dir/../../data2", base + "2/secret", base + "/../data2",
+		"file://" + base + "/../data2", "file://" + base + "/%2e%2e/data2", "file:///" + base + "/..%2fdata2",
+		"outside/secret", "escape", "inside/../../data2", "dangling/x", "//..//", "file://..", "./../",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		for _, bs := range stores {
+			fullPath, err := bs.getFullPath(path)
+			if err != nil {
+				continue
+			}
+			if fullPath != filepath.Clean(fullPath) || !isSubPath(bs.basePath, fullPath) {
+				t.Fatalf("%s policy: %q resolved to %s outside %s", bs.symlinks, path, fullPath, bs.basePath)
+			}
+			if bs.symlinks == SymlinkFollow {
+				continue
+			}
+			realPath, err := evalExistingSymlinks(fullPath)
+			if err == nil && !isSubPath(bs.realBasePath, realPath) {
+				t.Fatalf("%s policy: %q resolved to %s through a symlink", bs.symlinks, path, realPath)
+			}
+		}
+	})
+}
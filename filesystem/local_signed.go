@@ -0,0 +1,158 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ConfigSignKey the HMAC key of local signed URLs, a random key is used when empty,
+	// its URLs then only verify in the same process
+	ConfigSignKey = "signKey"
+	// ConfigURLPrefix where SignedURLHandler is served, e.g. https://example.com/files,
+	// signed URLs are relative to it
+	ConfigURLPrefix = "urlPrefix"
+)
+
+const (
+	signedURLExpires   = "Expires"
+	signedURLSignature = "Signature"
+)
+
+func newSignKey(config map[string]string) ([]byte, error) {
+	if v := config[ConfigSignKey]; v != "" {
+		return []byte(v), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate sign key error: %v", err)
+	}
+	return key, nil
+}
+
+// sign returns the signature of the slash separated path relative to basePath
+func (f *localBlobStore) sign(rel string, expires string) string {
+	mac := hmac.New(sha256.New, f.signKey)
+	mac.Write([]byte(rel + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (f *localBlobStore) getSignedURL(ctx context.Context, path string, expire time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	fullPath, err := f.getFullPath(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(f.basePath, fullPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", fmt.Errorf("%w: cannot sign basePath", ErrIsDir)
+	}
+	rel = filepath.ToSlash(rel)
+	if expire == 0 {
+		expire = defaultExpire
+	}
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	query := url.Values{}
+	query.Set(signedURLExpires, expires)
+	query.Set(signedURLSignature, f.sign(rel, expires))
+	escaped := (&url.URL{Path: "/" + rel}).EscapedPath()
+	return strings.TrimSuffix(f.config[ConfigURLPrefix], "/") + escaped + "?" + query.Encode(), nil
+}
+
+// SignedURLHandler serves the URLs signed by GetSignedURL of a local store,
+// after checking the signature and expiry. Range, conditional and HEAD requests are supported.
+func SignedURLHandler(bs BlobStore) (http.Handler, error) {
+	local, ok := unwrapBlobStore(bs).(localStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: signed url handler for %T", ErrUnsupported, bs)
+	}
+	f := local.local()
+	prefix, err := url.Parse(f.config[ConfigURLPrefix])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ConfigURLPrefix, err)
+	}
+	return &signedURLHandler{store: f, pathPrefix: strings.TrimSuffix(prefix.Path, "/")}, nil
+}
+
+type signedURLHandler struct {
+	store *localBlobStore
+	// pathPrefix the path of ConfigURLPrefix, stripped from the request path
+	pathPrefix string
+}
+
+func (h *signedURLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, h.pathPrefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	rel := strings.TrimPrefix(r.URL.Path, h.pathPrefix+"/")
+	query := r.URL.Query()
+	expires, signature := query.Get(signedURLExpires), query.Get(signedURLSignature)
+	if !hmac.Equal([]byte(signature), []byte(h.store.sign(rel, expires))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		http.Error(w, "url expired", http.StatusForbidden)
+		return
+	}
+
+	meta, err := h.store.getMeta(r.Context(), rel)
+	if err != nil {
+		writeBlobError(w, err)
+		return
+	}
+	file, err := os.Open(meta.URLPath)
+	if err != nil {
+		writeBlobError(w, err)
+		return
+	}
+	defer file.Close()
+	header := w.Header()
+	header.Set("Content-Type", meta.ContentType)
+	header.Set("ETag", strconv.Quote(meta.ETag))
+	if meta.ContentEncoding != "" {
+		header.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	if meta.CacheControl != "" {
+		header.Set("Cache-Control", meta.CacheControl)
+	}
+	http.ServeContent(w, r, meta.Name, meta.LastModified, file)
+}
+
+func writeBlobError(w http.ResponseWriter, err error) {
+	err = classifyError(err)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrIsDir), errors.Is(err, ErrNotDir):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidPath):
+		http.Error(w, "invalid path", http.StatusBadRequest)
+	case errors.Is(err, ErrPermission):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
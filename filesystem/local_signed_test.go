@@ -0,0 +1,134 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalSignedURL(t *testing.T) {
+	bs, err := NewBlobStore(KindLocal, t.TempDir(), map[string]string{
+		ConfigSignKey:   "secret",
+		ConfigURLPrefix: "/files",
+	})
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	err = WriteRawWithOptions(bs, "my-bucket/hello world", strings.NewReader("hello world"), WriteOptions{
+		ContentType:  "text/x-hello",
+		CacheControl: "no-cache",
+	})
+	if err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	handler, err := SignedURLHandler(bs)
+	if err != nil {
+		t.Fatalf("signed url handler error: %v", err)
+	}
+	signed, err := bs.GetSignedURL("my-bucket/hello world", time.Minute)
+	if err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	if !strings.HasPrefix(signed, "/files/my-bucket/hello%20world?") {
+		t.Fatalf("signed url: %s", signed)
+	}
+	expired, err := bs.GetSignedURL("my-bucket/hello world", -time.Minute)
+	if err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	query.Set(signedURLSignature, query.Get(signedURLSignature)[1:]+"A")
+	tampered := u.EscapedPath() + "?" + query.Encode()
+	otherPath := strings.Replace(signed, "hello%20world", "other", 1)
+
+	testCases := []struct {
+		desc       string
+		method     string
+		url        string
+		rangeSpec  string
+		wantStatus int
+		wantBody   string
+	}{
+		{desc: "get", method: http.MethodGet, url: signed, wantStatus: http.StatusOK, wantBody: "hello world"},
+		{desc: "head", method: http.MethodHead, url: signed, wantStatus: http.StatusOK},
+		{desc: "range", method: http.MethodGet, url: signed, rangeSpec: "bytes=6-", wantStatus: http.StatusPartialContent, wantBody: "world"},
+		{desc: "expired", method: http.MethodGet, url: expired, wantStatus: http.StatusForbidden},
+		{desc: "tampered signature", method: http.MethodGet, url: tampered, wantStatus: http.StatusForbidden},
+		{desc: "signature of another path", method: http.MethodGet, url: otherPath, wantStatus: http.StatusForbidden},
+		{desc: "unsigned", method: http.MethodGet, url: "/files/my-bucket/hello%20world", wantStatus: http.StatusForbidden},
+		{desc: "outside prefix", method: http.MethodGet, url: "/other/my-bucket/hello%20world", wantStatus: http.StatusNotFound},
+		{desc: "put", method: http.MethodPut, url: signed, wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if tc.rangeSpec != "" {
+				req.Header.Set("Range", tc.rangeSpec)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			resp := rec.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("status: %d %s, want %d", resp.StatusCode, body, tc.wantStatus)
+			}
+			if tc.wantStatus >= 300 {
+				return
+			}
+			if string(body) != tc.wantBody {
+				t.Fatalf("body: %q, want %q", body, tc.wantBody)
+			}
+			if resp.Header.Get("Content-Type") != "text/x-hello" || resp.Header.Get("Cache-Control") != "no-cache" {
+				t.Fatalf("headers: %v", resp.Header)
+			}
+			if tc.method == http.MethodHead && resp.Header.Get("Content-Length") != "11" {
+				t.Fatalf("head content length: %s", resp.Header.Get("Content-Length"))
+			}
+		})
+	}
+
+	if err = bs.WriteRaw("my-bucket/empty", strings.NewReader("")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	empty, err := bs.GetSignedURL("my-bucket/empty", time.Minute)
+	if err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, empty, nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("empty file: %d %q, want %d", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+	if got, want := rec.Header().Get("Content-Type"), http.DetectContentType(nil); got != want {
+		t.Fatalf("empty file content type: %s, want %s", got, want)
+	}
+
+	if err = bs.DeleteRaw("my-bucket/hello world"); err != nil {
+		t.Fatalf("delete raw error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted file status: %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// the URLs of a decorated local store are served too
+	wrapped, err := SignedURLHandler(WithRetry(bs, RetryOptions{}))
+	if err != nil {
+		t.Fatalf("signed url handler of a wrapped store error: %v", err)
+	}
+	rec = httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, empty, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wrapped store status: %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if _, err = SignedURLHandler(bsSet[BlobStoreMem]); err == nil {
+		t.Fatalf("signed url handler for a mem store")
+	}
+}
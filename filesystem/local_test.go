@@ -96,3 +96,39 @@ func TestLocalBuildURL(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalMetaFields(t *testing.T) {
+	bs := bsSet[BlobStoreLocal]
+	path := "my-bucket/fields/sub/hello"
+	if err := bs.WriteRaw(path, strings.NewReader("hello world")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer bs.DeleteRaw(path)
+
+	dirs, err := bs.ListMeta("my-bucket/fields", ListMetaOption{DirectoryOnly: true})
+	if err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if len(dirs) != 1 || !dirs[0].IsDir || !dirs[0].Mode.IsDir() {
+		t.Fatalf("directory metas: %+v", dirs)
+	}
+
+	files, err := bs.ListMeta("my-bucket/fields", ListMetaOption{})
+	if err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if len(files) != 1 || files[0].IsDir || !files[0].Mode.IsRegular() || files[0].ETag == "" {
+		t.Fatalf("file metas: %+v", files)
+	}
+
+	if err = bs.WriteRaw(path, strings.NewReader("hello world, again")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	meta, err := bs.GetMeta(path)
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	if meta.ETag == files[0].ETag {
+		t.Fatalf("etag %s did not change after rewrite", meta.ETag)
+	}
+}
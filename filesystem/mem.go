@@ -0,0 +1,485 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+	etag         string
+	opts         WriteOptions
+}
+
+// memBlobStore keeps objects in memory, for tests and short-lived pipelines.
+// Keys are flat like s3, directories only exist as common prefixes of keys.
+type memBlobStore struct {
+	config  map[string]string
+	name    string
+	mu      sync.RWMutex
+	objects map[string]*memObject
+}
+
+var (
+	_ BlobStore        = &memBlobStore{}
+	_ ContextBlobStore = &memBlobStore{}
+	_ Pager            = &memBlobStore{}
+	_ Walker           = &memBlobStore{}
+	_ RangeReader      = &memBlobStore{}
+	_ OptionsWriter    = &memBlobStore{}
+	_ Copier           = &memBlobStore{}
+)
+
+func newMemBlobStore(name string, config map[string]string) (*memBlobStore, error) {
+	name = strings.Trim(name, Delimiter)
+	if name == "" {
+		name = "default"
+	}
+	return &memBlobStore{
+		config:  config,
+		name:    name,
+		objects: make(map[string]*memObject),
+	}, nil
+}
+
+// getKey
+// format1: mem://name/subPath --> subPath
+// format2: subPath --> subPath
+func (m *memBlobStore) getKey(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPath, err)
+	}
+	switch u.Scheme {
+	case "":
+	case KindMem:
+		if u.Host != m.name {
+			return "", fmt.Errorf("%w: path %s does not belong to mem store %s", ErrInvalidPath, uri, m.name)
+		}
+		uri = u.Path
+	default:
+		return "", fmt.Errorf("%w: scheme should be empty or %s", ErrInvalidPath, KindMem)
+	}
+	key := strings.TrimPrefix(path.Clean("/"+uri), "/")
+	return key, nil
+}
+
+func (m *memBlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return m.ListMetaWithContext(context.Background(), path, option)
+}
+
+// ListMetaWithContext follows s3 semantics: keys are returned in lexical order after StartAfter,
+// with DirectoryOnly both objects and directories of the same level count into MaxKeys
+func (m *memBlobStore) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	metas, err := m.listMeta(ctx, path, option)
+	return metas, newBlobError("ListMeta", path, err)
+}
+
+func (m *memBlobStore) listMeta(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+	prefix := key
+	if prefix != "" {
+		prefix += Delimiter
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0)
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	metas := make([]*BlobMeta, 0)
+	var count int64
+	lastDir := ""
+	for _, k := range keys {
+		if option.MaxKeys > 0 && count >= option.MaxKeys {
+			break
+		}
+		if option.StartAfter != "" && k <= option.StartAfter {
+			continue
+		}
+		if !option.DirectoryOnly {
+			metas = append(metas, m.newBlobMeta(k, m.objects[k]))
+			count++
+			continue
+		}
+		idx := strings.Index(k[len(prefix):], Delimiter)
+		if idx == -1 {
+			// object of the same level
+			count++
+			continue
+		}
+		dir := k[:len(prefix)+idx]
+		if dir == lastDir {
+			continue
+		}
+		lastDir = dir
+		metas = append(metas, &BlobMeta{
+			Name:    dir,
+			URLPath: m.fetchURLPath(dir),
+			IsDir:   true,
+		})
+		count++
+	}
+	return metas, nil
+}
+
+func (m *memBlobStore) ListPage(path, cursor string, limit int64) (*MetaPage, error) {
+	page, err := m.listPage(path, cursor, limit)
+	return page, newBlobError("ListPage", path, err)
+}
+
+// listPage the cursor is the last returned key
+func (m *memBlobStore) listPage(path, cursor string, limit int64) (*MetaPage, error) {
+	key, err := m.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+	prefix := key
+	if prefix != "" {
+		prefix += Delimiter
+	}
+	after := ""
+	if cursor != "" {
+		if after, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+	limit = pageLimit(limit)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0)
+	for k := range m.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	page := &MetaPage{Metas: make([]*BlobMeta, 0)}
+	if int64(len(keys)) > limit {
+		keys = keys[:limit]
+		page.IsTruncated = true
+		page.NextCursor = encodeCursor(keys[len(keys)-1])
+	}
+	for _, k := range keys {
+		page.Metas = append(page.Metas, m.newBlobMeta(k, m.objects[k]))
+	}
+	return page, nil
+}
+
+func (m *memBlobStore) Walk(path string, fn WalkFunc) error {
+	key, err := m.getKey(path)
+	if err != nil {
+		return newBlobError("Walk", path, err)
+	}
+	prefix := key
+	if prefix != "" {
+		prefix += Delimiter
+	}
+	m.mu.RLock()
+	metas := make([]*BlobMeta, 0)
+	for k, obj := range m.objects {
+		if strings.HasPrefix(k, prefix) {
+			metas = append(metas, m.newBlobMeta(k, obj))
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+
+	w := newFlatWalker(key, fn)
+	for _, meta := range metas {
+		if err = w.visit(meta); err != nil {
+			return w.result(err)
+		}
+	}
+	return nil
+}
+
+func (m *memBlobStore) newBlobMeta(key string, obj *memObject) *BlobMeta {
+	meta := &BlobMeta{
+		Name:         key,
+		ContentType:  obj.contentType,
+		Size:         int64(len(obj.data)),
+		URLPath:      m.fetchURLPath(key),
+		LastModified: obj.lastModified,
+		ETag:         obj.etag,
+	}
+	obj.opts.apply(meta)
+	return meta
+}
+
+func (m *memBlobStore) fetchURLPath(key string) string {
+	return KindMem + "://" + m.name + "/" + key
+}
+
+func (m *memBlobStore) getObject(key string) (*memObject, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return obj, nil
+}
+
+func (m *memBlobStore) GetMeta(path string) (*BlobMeta, error) {
+	return m.GetMetaWithContext(context.Background(), path)
+}
+
+func (m *memBlobStore) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	meta, err := m.getMeta(ctx, path)
+	return meta, newBlobError("GetMeta", path, err)
+}
+
+func (m *memBlobStore) getMeta(ctx context.Context, path string) (*BlobMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := m.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.newBlobMeta(key, obj), nil
+}
+
+func (m *memBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	return m.ReadRawWithContext(context.Background(), path)
+}
+
+func (m *memBlobStore) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := m.readRaw(ctx, path)
+	return rc, newBlobError("ReadRaw", path, err)
+}
+
+func (m *memBlobStore) readRaw(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := m.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	// obj.data is never modified in place, a write replaces the whole object
+	return newContextReadCloser(ctx, ioutil.NopCloser(bytes.NewReader(obj.data))), nil
+}
+
+func (m *memBlobStore) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := m.readRange(path, offset, length)
+	return rc, newBlobError("ReadRange", path, err)
+}
+
+func (m *memBlobStore) readRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, errNegativeOffset
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := m.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	data := obj.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memBlobStore) WriteRaw(path string, in io.Reader) error {
+	return m.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (m *memBlobStore) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	return newBlobError("WriteRaw", path, m.writeRaw(ctx, path, in, WriteOptions{}))
+}
+
+func (m *memBlobStore) WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error {
+	return newBlobError("WriteRawWithOptions", path, m.writeRaw(context.Background(), path, in, opts))
+}
+
+func (m *memBlobStore) writeRaw(ctx context.Context, path string, in io.Reader, opts WriteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: key cannot be empty", ErrInvalidPath)
+	}
+	var verifier *checksumVerifier
+	if opts.Checksum != "" {
+		if verifier, err = newChecksumVerifier(path, in, opts.Checksum); err != nil {
+			return err
+		}
+		in = verifier
+	}
+	data, err := ioutil.ReadAll(newContextReader(ctx, in))
+	if err != nil {
+		return err
+	}
+	if verifier != nil {
+		if err = verifier.check(); err != nil {
+			return err
+		}
+	}
+	obj := &memObject{
+		data:         data,
+		contentType:  http.DetectContentType(data),
+		lastModified: time.Now(),
+		etag:         fmt.Sprintf("%x", md5.Sum(data)),
+		opts:         opts.normalize(),
+	}
+	m.mu.Lock()
+	m.objects[key] = obj
+	m.mu.Unlock()
+	return nil
+}
+
+// CopyRawFrom shares the object with the source, objects are never modified in place
+func (m *memBlobStore) CopyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	return newBlobError("CopyRawFrom", destPath, m.copyRawFrom(ctx, source, sourcePath, destPath))
+}
+
+var _ copySourceChecker = &memBlobStore{}
+
+func (m *memBlobStore) canCopyFrom(source BlobStore) bool {
+	_, ok := unwrapBlobStore(source).(*memBlobStore)
+	return ok
+}
+
+func (m *memBlobStore) copyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	src, ok := unwrapBlobStore(source).(*memBlobStore)
+	if !ok {
+		return fmt.Errorf("%w: mem copy from %T", ErrUnsupported, source)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srcKey, err := src.getKey(sourcePath)
+	if err != nil {
+		return err
+	}
+	key, err := m.getKey(destPath)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: key cannot be empty", ErrInvalidPath)
+	}
+	obj, err := src.getObject(srcKey)
+	if err != nil {
+		return err
+	}
+	copied := *obj
+	copied.lastModified = time.Now()
+	m.mu.Lock()
+	m.objects[key] = &copied
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memBlobStore) DeleteRaw(path string) error {
+	return m.DeleteRawWithContext(context.Background(), path)
+}
+
+func (m *memBlobStore) DeleteRawWithContext(ctx context.Context, path string) error {
+	return newBlobError("DeleteRaw", path, m.deleteRaw(ctx, path))
+}
+
+func (m *memBlobStore) deleteRaw(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memBlobStore) GetSignedURL(path string, expire time.Duration) (string, error) {
+	return m.GetSignedURLWithContext(context.Background(), path, expire)
+}
+
+// GetSignedURLWithContext returns a fake signed url, it is not served by anything
+func (m *memBlobStore) GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error) {
+	signed, err := m.getSignedURL(ctx, path, expire)
+	return signed, newBlobError("GetSignedURL", path, err)
+}
+
+func (m *memBlobStore) getSignedURL(ctx context.Context, path string, expire time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	key, err := m.getKey(path)
+	if err != nil {
+		return "", err
+	}
+	if expire == 0 {
+		expire = defaultExpire
+	}
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	sum := sha256.Sum256([]byte(m.name + "/" + key + "?" + expires))
+	query := url.Values{}
+	query.Set("Expires", expires)
+	query.Set("Signature", hex.EncodeToString(sum[:]))
+	return m.fetchURLPath(key) + "?" + query.Encode(), nil
+}
+
+func (m *memBlobStore) BuildURL(path string) (string, error) {
+	key, err := m.getKey(path)
+	if err != nil {
+		return "", err
+	}
+	return m.fetchURLPath(key), nil
+}
@@ -0,0 +1,165 @@
+package filesystem
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestMemBlobStore(t *testing.T, keys ...string) BlobStore {
+	bs, err := NewBlobStore(KindMem, "test", nil)
+	if err != nil {
+		t.Fatalf("new mem blob store error: %v", err)
+	}
+	for _, key := range keys {
+		if err = bs.WriteRaw(key, strings.NewReader(key)); err != nil {
+			t.Fatalf("write raw error: %v", err)
+		}
+	}
+	return bs
+}
+
+func TestMemListMeta(t *testing.T) {
+	bs := newTestMemBlobStore(t, "a/1", "a/2", "a/b/3", "a/c/4", "a/c/5", "a/d", "e/6")
+
+	testCases := []struct {
+		desc      string
+		path      string
+		option    ListMetaOption
+		wantNames []string
+	}{
+		{
+			desc:      "recursive",
+			path:      "a",
+			wantNames: []string{"a/1", "a/2", "a/b/3", "a/c/4", "a/c/5", "a/d"},
+		},
+		{
+			desc:      "root",
+			path:      "",
+			wantNames: []string{"a/1", "a/2", "a/b/3", "a/c/4", "a/c/5", "a/d", "e/6"},
+		},
+		{
+			desc:      "directory only",
+			path:      "a",
+			option:    ListMetaOption{DirectoryOnly: true},
+			wantNames: []string{"a/b", "a/c"},
+		},
+		{
+			desc:      "max keys",
+			path:      "a",
+			option:    ListMetaOption{MaxKeys: 2},
+			wantNames: []string{"a/1", "a/2"},
+		},
+		{
+			desc:      "directory only counts objects into max keys",
+			path:      "a",
+			option:    ListMetaOption{DirectoryOnly: true, MaxKeys: 3},
+			wantNames: []string{"a/b"},
+		},
+		{
+			desc:      "start after",
+			path:      "a",
+			option:    ListMetaOption{StartAfter: "a/b/3"},
+			wantNames: []string{"a/c/4", "a/c/5", "a/d"},
+		},
+		{
+			desc:      "uri format",
+			path:      "mem://test/a/c",
+			wantNames: []string{"a/c/4", "a/c/5"},
+		},
+		{
+			desc:      "not exist",
+			path:      "x",
+			wantNames: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			metas, err := bs.ListMeta(tc.path, tc.option)
+			if err != nil {
+				t.Fatalf("list meta error: %v", err)
+			}
+			names := make([]string, len(metas))
+			for i, meta := range metas {
+				names[i] = meta.Name
+			}
+			if strings.Join(names, ",") != strings.Join(tc.wantNames, ",") {
+				t.Fatalf("names: %v, want: %v", names, tc.wantNames)
+			}
+		})
+	}
+}
+
+func TestMemGetMeta(t *testing.T) {
+	bs := newTestMemBlobStore(t, "my-bucket/hello")
+	meta, err := bs.GetMeta("/my-bucket/hello")
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	wantMeta := BlobMeta{
+		Name:        "my-bucket/hello",
+		ContentType: "text/plain; charset=utf-8",
+		Size:        15,
+		URLPath:     "mem://test/my-bucket/hello",
+	}
+	if !equal(*meta, wantMeta) {
+		t.Fatalf("get meta: %v, but want: %v", *meta, wantMeta)
+	}
+
+	if _, err = bs.GetMeta("my-bucket/missing"); err == nil {
+		t.Fatal("get meta of missing object should fail")
+	}
+	if err = bs.DeleteRaw("my-bucket/missing"); err == nil {
+		t.Fatal("delete missing object should fail")
+	}
+	if _, err = bs.GetMeta("mem://other/my-bucket/hello"); err == nil {
+		t.Fatal("get meta from another store should fail")
+	}
+}
+
+func TestMemGetSignedURL(t *testing.T) {
+	bs := newTestMemBlobStore(t, "hello")
+	signed, err := bs.GetSignedURL("hello", 0)
+	if err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed url error: %v", err)
+	}
+	if u.Scheme != KindMem || u.Host != "test" || u.Path != "/hello" {
+		t.Fatalf("unexpected signed url: %s", signed)
+	}
+	if u.Query().Get("Expires") == "" || u.Query().Get("Signature") == "" {
+		t.Fatalf("signed url misses signature: %s", signed)
+	}
+}
+
+func TestMemConcurrentWrite(t *testing.T) {
+	bs := newTestMemBlobStore(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("dir/%02d", i)
+			if err := bs.WriteRaw(key, strings.NewReader(key)); err != nil {
+				t.Errorf("write raw error: %v", err)
+			}
+			if _, err := bs.ListMeta("dir", ListMetaOption{}); err != nil {
+				t.Errorf("list meta error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	metas, err := bs.ListMeta("dir", ListMetaOption{})
+	if err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if len(metas) != 50 {
+		t.Fatalf("list %d metas, want 50", len(metas))
+	}
+}
@@ -0,0 +1,250 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Direction of the bytes transferred by a call
+type Direction string
+
+const (
+	DirectionRead  Direction = "read"
+	DirectionWrite Direction = "write"
+)
+
+// MetricsCollector receives the measures of the stores wrapped by WithMetrics
+type MetricsCollector interface {
+	// ObserveCall records a finished call, err is nil on success.
+	// The call of a stream read finishes when the stream is closed.
+	ObserveCall(backend, op string, latency time.Duration, err error)
+	// ObserveBytes records bytes transferred by a call, it is called while the bytes flow
+	ObserveBytes(backend, op string, direction Direction, n int64)
+}
+
+var errorClasses = map[error]string{
+	ErrNotFound:         "not_found",
+	ErrAlreadyExists:    "already_exists",
+	ErrIsDir:            "is_dir",
+	ErrNotDir:           "not_dir",
+	ErrInvalidPath:      "invalid_path",
+	ErrUnsupported:      "unsupported",
+	ErrPermission:       "permission",
+	ErrThrottled:        "throttled",
+	ErrChecksumMismatch: "checksum_mismatch",
+}
+
+// ErrorClass a label for the kind of err: the Err* sentinel it matches, "canceled",
+// "deadline_exceeded" or "unknown". It is empty for a nil error.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+	if kind := classifyError(err); kind != nil {
+		return errorClasses[kind]
+	}
+	return "unknown"
+}
+
+// WithMetrics returns bs reporting its calls to collector, labelled with backend
+func WithMetrics(bs BlobStore, backend string, collector MetricsCollector) BlobStore {
+	return &wrappedBlobStore{inner: bs, mw: &metricsMiddleware{backend: backend, collector: collector}}
+}
+
+type metricsMiddleware struct {
+	backend   string
+	collector MetricsCollector
+}
+
+var _ middleware = &metricsMiddleware{}
+
+func (m *metricsMiddleware) call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	err := fn(ctx)
+	m.collector.ObserveCall(m.backend, op, time.Since(start), err)
+	return err
+}
+
+func (m *metricsMiddleware) read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	start := time.Now()
+	rc, err := fn(ctx)
+	if err != nil {
+		m.collector.ObserveCall(m.backend, op, time.Since(start), err)
+		return nil, err
+	}
+	return &meteredReadCloser{rc: rc, m: m, op: op, start: start}, nil
+}
+
+func (m *metricsMiddleware) write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error {
+	start := time.Now()
+	err := fn(ctx, hookReader(in, func(n int) error {
+		if n > 0 {
+			m.collector.ObserveBytes(m.backend, op, DirectionWrite, int64(n))
+		}
+		return nil
+	}, nil))
+	m.collector.ObserveCall(m.backend, op, time.Since(start), err)
+	return err
+}
+
+func (m *metricsMiddleware) download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error) {
+	start := time.Now()
+	n, err := fn(ctx, wa)
+	m.collector.ObserveBytes(m.backend, op, DirectionRead, n)
+	m.collector.ObserveCall(m.backend, op, time.Since(start), err)
+	return n, err
+}
+
+// meteredReadCloser reports the bytes of a read, the call is observed once closed with the first read error
+type meteredReadCloser struct {
+	rc    io.ReadCloser
+	m     *metricsMiddleware
+	op    string
+	start time.Time
+	err   error
+	once  sync.Once
+}
+
+func (r *meteredReadCloser) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		r.m.collector.ObserveBytes(r.m.backend, r.op, DirectionRead, int64(n))
+	}
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *meteredReadCloser) Close() error {
+	err := r.rc.Close()
+	r.once.Do(func() {
+		if r.err == nil {
+			r.err = err
+		}
+		r.m.collector.ObserveCall(r.m.backend, r.op, time.Since(r.start), r.err)
+	})
+	return err
+}
+
+// DefaultLatencyBuckets upper bounds of the latency histograms of a MetricsRegistry
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// OperationMetrics the measures of an operation of a backend
+type OperationMetrics struct {
+	Backend string `json:"backend"`
+	Op      string `json:"op"`
+	Calls   int64  `json:"calls"`
+	// Errors failed calls keyed by ErrorClass
+	Errors       map[string]int64 `json:"errors,omitempty"`
+	BytesRead    int64            `json:"bytesRead"`
+	BytesWritten int64            `json:"bytesWritten"`
+	// LatencyCounts calls at most as long as the bucket of the same index, the last one counts the slower calls
+	LatencyCounts []int64       `json:"latencyCounts"`
+	LatencySum    time.Duration `json:"latencySum"`
+}
+
+// MetricsRegistry a MetricsCollector keeping the measures in memory,
+// they are exported with WritePrometheus and PublishExpvar.
+type MetricsRegistry struct {
+	buckets []time.Duration
+
+	mu  sync.Mutex
+	ops map[metricsKey]*OperationMetrics
+}
+
+type metricsKey struct {
+	backend, op string
+}
+
+var _ MetricsCollector = &MetricsRegistry{}
+
+// NewMetricsRegistry returns a registry using buckets for the latency histograms, DefaultLatencyBuckets if empty
+func NewMetricsRegistry(buckets ...time.Duration) *MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &MetricsRegistry{buckets: buckets, ops: make(map[metricsKey]*OperationMetrics)}
+}
+
+// Buckets the upper bounds of the latency histograms
+func (r *MetricsRegistry) Buckets() []time.Duration {
+	return append([]time.Duration(nil), r.buckets...)
+}
+
+func (r *MetricsRegistry) operation(backend, op string) *OperationMetrics {
+	key := metricsKey{backend: backend, op: op}
+	metrics, ok := r.ops[key]
+	if !ok {
+		metrics = &OperationMetrics{Backend: backend, Op: op, LatencyCounts: make([]int64, len(r.buckets)+1)}
+		r.ops[key] = metrics
+	}
+	return metrics
+}
+
+func (r *MetricsRegistry) ObserveCall(backend, op string, latency time.Duration, err error) {
+	bucket := sort.Search(len(r.buckets), func(i int) bool { return latency <= r.buckets[i] })
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics := r.operation(backend, op)
+	metrics.Calls++
+	metrics.LatencyCounts[bucket]++
+	metrics.LatencySum += latency
+	if err != nil {
+		if metrics.Errors == nil {
+			metrics.Errors = make(map[string]int64)
+		}
+		metrics.Errors[ErrorClass(err)]++
+	}
+}
+
+func (r *MetricsRegistry) ObserveBytes(backend, op string, direction Direction, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics := r.operation(backend, op)
+	if direction == DirectionWrite {
+		metrics.BytesWritten += n
+	} else {
+		metrics.BytesRead += n
+	}
+}
+
+// Snapshot a copy of the measures sorted by backend and op
+func (r *MetricsRegistry) Snapshot() []OperationMetrics {
+	r.mu.Lock()
+	snapshot := make([]OperationMetrics, 0, len(r.ops))
+	for _, metrics := range r.ops {
+		m := *metrics
+		m.LatencyCounts = append([]int64(nil), metrics.LatencyCounts...)
+		if metrics.Errors != nil {
+			m.Errors = make(map[string]int64, len(metrics.Errors))
+			for class, n := range metrics.Errors {
+				m.Errors[class] = n
+			}
+		}
+		snapshot = append(snapshot, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Backend != snapshot[j].Backend {
+			return snapshot[i].Backend < snapshot[j].Backend
+		}
+		return snapshot[i].Op < snapshot[j].Op
+	})
+	return snapshot
+}
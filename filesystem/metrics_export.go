@@ -0,0 +1,117 @@
+package filesystem
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func prometheusLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(prometheusLabelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func prometheusFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WritePrometheus writes the measures in the Prometheus text exposition format
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	snapshot := r.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "# HELP blobstore_operations_total BlobStore calls.")
+	fmt.Fprintln(bw, "# TYPE blobstore_operations_total counter")
+	for _, m := range snapshot {
+		fmt.Fprintf(bw, "blobstore_operations_total%s %d\n", prometheusLabels("backend", m.Backend, "op", m.Op), m.Calls)
+	}
+
+	fmt.Fprintln(bw, "# HELP blobstore_operation_errors_total BlobStore calls failed, by error class.")
+	fmt.Fprintln(bw, "# TYPE blobstore_operation_errors_total counter")
+	for _, m := range snapshot {
+		classes := make([]string, 0, len(m.Errors))
+		for class := range m.Errors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(bw, "blobstore_operation_errors_total%s %d\n",
+				prometheusLabels("backend", m.Backend, "op", m.Op, "error", class), m.Errors[class])
+		}
+	}
+
+	fmt.Fprintln(bw, "# HELP blobstore_operation_duration_seconds BlobStore call latency, stream reads last until closed.")
+	fmt.Fprintln(bw, "# TYPE blobstore_operation_duration_seconds histogram")
+	for _, m := range snapshot {
+		var cumulative int64
+		for i, bound := range r.buckets {
+			cumulative += m.LatencyCounts[i]
+			fmt.Fprintf(bw, "blobstore_operation_duration_seconds_bucket%s %d\n",
+				prometheusLabels("backend", m.Backend, "op", m.Op, "le", prometheusFloat(bound.Seconds())), cumulative)
+		}
+		fmt.Fprintf(bw, "blobstore_operation_duration_seconds_bucket%s %d\n",
+			prometheusLabels("backend", m.Backend, "op", m.Op, "le", "+Inf"), m.Calls)
+		labels := prometheusLabels("backend", m.Backend, "op", m.Op)
+		fmt.Fprintf(bw, "blobstore_operation_duration_seconds_sum%s %s\n", labels, prometheusFloat(m.LatencySum.Seconds()))
+		fmt.Fprintf(bw, "blobstore_operation_duration_seconds_count%s %d\n", labels, m.Calls)
+	}
+
+	fmt.Fprintln(bw, "# HELP blobstore_bytes_total Bytes transferred by BlobStore calls.")
+	fmt.Fprintln(bw, "# TYPE blobstore_bytes_total counter")
+	for _, m := range snapshot {
+		if m.BytesRead > 0 {
+			fmt.Fprintf(bw, "blobstore_bytes_total%s %d\n",
+				prometheusLabels("backend", m.Backend, "op", m.Op, "direction", string(DirectionRead)), m.BytesRead)
+		}
+		if m.BytesWritten > 0 {
+			fmt.Fprintf(bw, "blobstore_bytes_total%s %d\n",
+				prometheusLabels("backend", m.Backend, "op", m.Op, "direction", string(DirectionWrite)), m.BytesWritten)
+		}
+	}
+	return bw.Flush()
+}
+
+// PrometheusHandler serves the measures of r to a Prometheus scraper
+func PrometheusHandler(r *MetricsRegistry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// ExpvarValue the measures keyed by backend then op, to be published with expvar.Publish
+func (r *MetricsRegistry) ExpvarValue() expvar.Var {
+	return expvar.Func(func() interface{} {
+		backends := make(map[string]map[string]OperationMetrics)
+		for _, m := range r.Snapshot() {
+			if backends[m.Backend] == nil {
+				backends[m.Backend] = make(map[string]OperationMetrics)
+			}
+			backends[m.Backend][m.Op] = m
+		}
+		return backends
+	})
+}
+
+// PublishExpvar publishes the measures under name in /debug/vars, it panics if name is already published
+func (r *MetricsRegistry) PublishExpvar(name string) {
+	expvar.Publish(name, r.ExpvarValue())
+}
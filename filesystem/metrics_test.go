@@ -0,0 +1,157 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorClass(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ""},
+		{err: newBlobError("GetMeta", "a", ErrNotFound), want: "not_found"},
+		{err: newS3Error("GetMeta", "a", fmt.Errorf("wrapped: %w", ErrThrottled)), want: "throttled"},
+		{err: &ChecksumMismatchError{Path: "a"}, want: "checksum_mismatch"},
+		{err: fmt.Errorf("read: %w", context.Canceled), want: "canceled"},
+		{err: context.DeadlineExceeded, want: "deadline_exceeded"},
+		{err: fmt.Errorf("boom"), want: "unknown"},
+	}
+
+	for _, tc := range testCases {
+		if got := ErrorClass(tc.err); got != tc.want {
+			t.Fatalf("error class of %v: %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	registry := NewMetricsRegistry()
+	bs := WithMetrics(newTestMemBlobStore(t), "mem", registry)
+
+	if err := bs.WriteRaw("a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	stream, err := bs.ReadRaw("a")
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	ioutil.ReadAll(stream)
+	// the read is observed once closed
+	if got := registry.Snapshot()[0]; got.Op != "ReadRaw" || got.Calls != 0 || got.BytesRead != 5 {
+		t.Fatalf("read raw before close: %+v", got)
+	}
+	stream.Close()
+	stream.Close()
+	if _, err = bs.GetMeta("missing"); err == nil {
+		t.Fatalf("get meta of a missing path succeeded")
+	}
+
+	snapshot := registry.Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("operations: %+v", snapshot)
+	}
+	getMeta, readRaw, writeRaw := snapshot[0], snapshot[1], snapshot[2]
+	if getMeta.Op != "GetMeta" || getMeta.Calls != 1 || getMeta.Errors["not_found"] != 1 {
+		t.Fatalf("get meta metrics: %+v", getMeta)
+	}
+	if readRaw.Op != "ReadRaw" || readRaw.Calls != 1 || readRaw.BytesRead != 5 || len(readRaw.Errors) != 0 {
+		t.Fatalf("read raw metrics: %+v", readRaw)
+	}
+	if writeRaw.Op != "WriteRaw" || writeRaw.Calls != 1 || writeRaw.BytesWritten != 5 || writeRaw.Backend != "mem" {
+		t.Fatalf("write raw metrics: %+v", writeRaw)
+	}
+	var calls int64
+	for _, n := range writeRaw.LatencyCounts {
+		calls += n
+	}
+	if calls != 1 || len(writeRaw.LatencyCounts) != len(DefaultLatencyBuckets)+1 {
+		t.Fatalf("latency counts: %v", writeRaw.LatencyCounts)
+	}
+}
+
+func TestWithMetricsResumable(t *testing.T) {
+	s, fake, journalDir := newTestResumableStore(t)
+	s.transfer.concurrency = 1
+	data := make([]byte, 3*1024)
+	registry := NewMetricsRegistry()
+	bs := WithMetrics(s, "s3", registry)
+
+	fake.failPart = 2
+	if err := bs.WriteRaw("big", bytes.NewReader(data)); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	if journals, _ := filepath.Glob(filepath.Join(journalDir, "*.json")); len(journals) != 1 {
+		t.Fatalf("journals of a seekable write: %v", journals)
+	}
+	if err := bs.WriteRaw("big", bytes.NewReader(data)); err != nil {
+		t.Fatalf("resumed upload error: %v", err)
+	}
+	if fake.requests["CreateMultipartUpload"] != 1 || !bytes.Equal(fake.object("big"), data) {
+		t.Fatalf("upload not resumed: %v", fake.requests)
+	}
+	if got := registry.Snapshot()[0]; got.Op != "WriteRaw" || got.Calls != 2 || got.Errors["unknown"] != 1 {
+		t.Fatalf("write raw metrics: %+v", got)
+	}
+}
+
+func TestMetricsRegistryPrometheus(t *testing.T) {
+	registry := NewMetricsRegistry(time.Second, 10*time.Millisecond)
+	registry.ObserveCall("s3", "GetMeta", 5*time.Millisecond, nil)
+	registry.ObserveCall("s3", "GetMeta", 500*time.Millisecond, newBlobError("GetMeta", "a", ErrNotFound))
+	registry.ObserveCall("s3", "GetMeta", 2*time.Second, newBlobError("GetMeta", "a", ErrThrottled))
+	registry.ObserveCall(`lo"cal`, "ReadRaw", time.Millisecond, nil)
+	registry.ObserveBytes(`lo"cal`, "ReadRaw", DirectionRead, 42)
+
+	recorder := httptest.NewRecorder()
+	PrometheusHandler(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	want := `# HELP blobstore_operations_total BlobStore calls.
+# TYPE blobstore_operations_total counter
+blobstore_operations_total{backend="lo\"cal",op="ReadRaw"} 1
+blobstore_operations_total{backend="s3",op="GetMeta"} 3
+# HELP blobstore_operation_errors_total BlobStore calls failed, by error class.
+# TYPE blobstore_operation_errors_total counter
+blobstore_operation_errors_total{backend="s3",op="GetMeta",error="not_found"} 1
+blobstore_operation_errors_total{backend="s3",op="GetMeta",error="throttled"} 1
+# HELP blobstore_operation_duration_seconds BlobStore call latency, stream reads last until closed.
+# TYPE blobstore_operation_duration_seconds histogram
+blobstore_operation_duration_seconds_bucket{backend="lo\"cal",op="ReadRaw",le="0.01"} 1
+blobstore_operation_duration_seconds_bucket{backend="lo\"cal",op="ReadRaw",le="1"} 1
+blobstore_operation_duration_seconds_bucket{backend="lo\"cal",op="ReadRaw",le="+Inf"} 1
+blobstore_operation_duration_seconds_sum{backend="lo\"cal",op="ReadRaw"} 0.001
+blobstore_operation_duration_seconds_count{backend="lo\"cal",op="ReadRaw"} 1
+blobstore_operation_duration_seconds_bucket{backend="s3",op="GetMeta",le="0.01"} 1
+blobstore_operation_duration_seconds_bucket{backend="s3",op="GetMeta",le="1"} 2
+blobstore_operation_duration_seconds_bucket{backend="s3",op="GetMeta",le="+Inf"} 3
+blobstore_operation_duration_seconds_sum{backend="s3",op="GetMeta"} 2.505
+blobstore_operation_duration_seconds_count{backend="s3",op="GetMeta"} 3
+# HELP blobstore_bytes_total Bytes transferred by BlobStore calls.
+# TYPE blobstore_bytes_total counter
+blobstore_bytes_total{backend="lo\"cal",op="ReadRaw",direction="read"} 42
+`
+	if got := recorder.Body.String(); got != want {
+		t.Fatalf("prometheus text:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsRegistryExpvar(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.ObserveCall("s3", "GetMeta", time.Millisecond, newBlobError("GetMeta", "a", ErrNotFound))
+
+	var backends map[string]map[string]OperationMetrics
+	if err := json.Unmarshal([]byte(registry.ExpvarValue().String()), &backends); err != nil {
+		t.Fatalf("expvar json: %v", err)
+	}
+	if m := backends["s3"]["GetMeta"]; m.Calls != 1 || m.Errors["not_found"] != 1 || m.LatencySum != time.Millisecond {
+		t.Fatalf("expvar metrics: %+v", m)
+	}
+}
@@ -0,0 +1,281 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// ConfigFSTypes comma separated filesystem types accepted for the mount, overrides the kind defaults
+	ConfigFSTypes = "fsTypes"
+	// ConfigRetries times to retry an operation failed with a stale file handle or EIO
+	ConfigRetries = "retries"
+	// ConfigRetryInterval wait between retries, in time.ParseDuration format
+	ConfigRetryInterval = "retryInterval"
+)
+
+const (
+	defaultMountRetries       = 3
+	defaultMountRetryInterval = 100 * time.Millisecond
+)
+
+// defaultFSTypes filesystem types reported by the kernel for each mount-backed kind
+var defaultFSTypes = map[Kind][]string{
+	KindNFS:       {"nfs", "nfs4"},
+	KindCFS:       {"nfs", "nfs4", "fuse.cubefs", "fuse.chubaofs"},
+	KindGlusterFS: {"fuse.glusterfs", "glusterfs"},
+}
+
+type mountInfo struct {
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+// MountHealth describes the state of the mount backing a mount-backed blob store
+type MountHealth struct {
+	Kind       Kind   `json:"kind"`
+	MountPoint string `json:"mountPoint"`
+	FSType     string `json:"fsType"`
+	Source     string `json:"source"`
+	// TotalBytes and FreeBytes are 0 when the mount is unhealthy
+	TotalBytes uint64    `json:"totalBytes"`
+	FreeBytes  uint64    `json:"freeBytes"`
+	Healthy    bool      `json:"healthy"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// MountHealthChecker is implemented by the nfs, cfs and glusterfs blob stores
+type MountHealthChecker interface {
+	MountHealth() *MountHealth
+}
+
+// lookupMount finds the mount containing path, replaced in tests
+var lookupMount = findMount
+
+// mountBlobStore a localBlobStore whose basePath lives on a shared mount,
+// operations failing with ESTALE or EIO are retried
+type mountBlobStore struct {
+	*localBlobStore
+	kind          Kind
+	fsTypes       []string
+	mount         *mountInfo
+	retries       int
+	retryInterval time.Duration
+}
+
+var (
+	_ BlobStore          = &mountBlobStore{}
+	_ ContextBlobStore   = &mountBlobStore{}
+	_ Pager              = &mountBlobStore{}
+	_ RangeReader        = &mountBlobStore{}
+	_ OptionsWriter      = &mountBlobStore{}
+	_ MountHealthChecker = &mountBlobStore{}
+)
+
+func newMountBlobStore(kind Kind, basePath string, config map[string]string) (*mountBlobStore, error) {
+	local, err := newLocalBlobStore(basePath, config)
+	if err != nil {
+		return nil, err
+	}
+	fsTypes := defaultFSTypes[kind]
+	if v := config[ConfigFSTypes]; v != "" {
+		fsTypes = strings.Split(v, ",")
+	}
+	retries := defaultMountRetries
+	if v := config[ConfigRetries]; v != "" {
+		retries, err = strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("invalid %s: %s", ConfigRetries, v)
+		}
+	}
+	retryInterval := defaultMountRetryInterval
+	if v := config[ConfigRetryInterval]; v != "" {
+		retryInterval, err = time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", ConfigRetryInterval, err)
+		}
+	}
+
+	m := &mountBlobStore{
+		localBlobStore: local,
+		kind:           kind,
+		fsTypes:        fsTypes,
+		retries:        retries,
+		retryInterval:  retryInterval,
+	}
+	m.mount, err = m.checkMount()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkMount validates that basePath is on a mount of one of the expected filesystem types
+func (m *mountBlobStore) checkMount() (*mountInfo, error) {
+	realPath, err := filepath.EvalSymlinks(m.basePath)
+	if err != nil {
+		return nil, err
+	}
+	mi, err := lookupMount(realPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, fsType := range m.fsTypes {
+		if strings.TrimSpace(fsType) == mi.FSType {
+			return mi, nil
+		}
+	}
+	return nil, fmt.Errorf("basePath: %s is on %s mount %s, want one of %v", m.basePath, mi.FSType, mi.MountPoint, m.fsTypes)
+}
+
+func (m *mountBlobStore) MountHealth() *MountHealth {
+	health := &MountHealth{Kind: m.kind, CheckedAt: time.Now()}
+	mi, err := m.checkMount()
+	if err == nil {
+		health.MountPoint, health.FSType, health.Source = mi.MountPoint, mi.FSType, mi.Source
+		health.TotalBytes, health.FreeBytes, err = statMount(m.basePath)
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Healthy = true
+	return health
+}
+
+// isTransientMountError stale file handles and EIO are usually gone after the client reconnects
+func isTransientMountError(err error) bool {
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EIO)
+}
+
+func (m *mountBlobStore) retry(ctx context.Context, op func() error) error {
+	err := op()
+	for i := 0; i < m.retries && isTransientMountError(err); i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.retryInterval):
+		}
+		err = op()
+	}
+	return err
+}
+
+func (m *mountBlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return m.ListMetaWithContext(context.Background(), path, option)
+}
+
+func (m *mountBlobStore) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	var metas []*BlobMeta
+	err := m.retry(ctx, func() (err error) {
+		metas, err = m.localBlobStore.ListMetaWithContext(ctx, path, option)
+		return err
+	})
+	return metas, err
+}
+
+func (m *mountBlobStore) ListPage(path, cursor string, limit int64) (*MetaPage, error) {
+	return m.ListPageWithContext(context.Background(), path, cursor, limit)
+}
+
+func (m *mountBlobStore) ListPageWithContext(ctx context.Context, path, cursor string, limit int64) (*MetaPage, error) {
+	var page *MetaPage
+	err := m.retry(ctx, func() (err error) {
+		page, err = m.localBlobStore.ListPage(path, cursor, limit)
+		return err
+	})
+	return page, err
+}
+
+func (m *mountBlobStore) GetMeta(path string) (*BlobMeta, error) {
+	return m.GetMetaWithContext(context.Background(), path)
+}
+
+func (m *mountBlobStore) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	var meta *BlobMeta
+	err := m.retry(ctx, func() (err error) {
+		meta, err = m.localBlobStore.GetMetaWithContext(ctx, path)
+		return err
+	})
+	return meta, err
+}
+
+func (m *mountBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	return m.ReadRawWithContext(context.Background(), path)
+}
+
+// ReadRawWithContext only opening the file is retried, errors while streaming are returned as is
+func (m *mountBlobStore) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := m.retry(ctx, func() (err error) {
+		rc, err = m.localBlobStore.ReadRawWithContext(ctx, path)
+		return err
+	})
+	return rc, err
+}
+
+func (m *mountBlobStore) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := m.retry(context.Background(), func() (err error) {
+		rc, err = m.localBlobStore.ReadRange(path, offset, length)
+		return err
+	})
+	return rc, err
+}
+
+func (m *mountBlobStore) WriteRaw(path string, in io.Reader) error {
+	return m.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (m *mountBlobStore) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	return m.retryWrite(ctx, in, func() error {
+		return m.localBlobStore.WriteRawWithContext(ctx, path, in)
+	})
+}
+
+func (m *mountBlobStore) WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error {
+	return m.retryWrite(context.Background(), in, func() error {
+		return m.localBlobStore.WriteRawWithOptions(path, in, opts)
+	})
+}
+
+// retryWrite a failed write is only retried when in can be rewound
+func (m *mountBlobStore) retryWrite(ctx context.Context, in io.Reader, write func() error) error {
+	seeker, ok := in.(io.Seeker)
+	if !ok {
+		return write()
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return write()
+	}
+	first := true
+	return m.retry(ctx, func() error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return write()
+	})
+}
+
+func (m *mountBlobStore) DeleteRaw(path string) error {
+	return m.DeleteRawWithContext(context.Background(), path)
+}
+
+func (m *mountBlobStore) DeleteRawWithContext(ctx context.Context, path string) error {
+	return m.retry(ctx, func() error {
+		return m.localBlobStore.DeleteRawWithContext(ctx, path)
+	})
+}
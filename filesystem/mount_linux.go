@@ -0,0 +1,83 @@
+package filesystem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+func findMount(path string) (*mountInfo, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountInfo(f, path)
+}
+
+// parseMountInfo returns the deepest mount containing path, see proc(5) for the format:
+// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(r io.Reader, path string) (*mountInfo, error) {
+	var found *mountInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep == -1 || sep+2 >= len(fields) {
+			continue
+		}
+		mountPoint := unescapeMountField(fields[4])
+		if !isSubPath(mountPoint, path) {
+			continue
+		}
+		if found == nil || len(mountPoint) >= len(found.MountPoint) {
+			found = &mountInfo{MountPoint: mountPoint, FSType: fields[sep+1], Source: unescapeMountField(fields[sep+2])}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no mount found for %s", path)
+	}
+	return found, nil
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space) used in mountinfo
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func statMount(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,57 @@
+package filesystem
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountInfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 22 0:40 / /data rw,relatime shared:2 - nfs4 10.0.0.1:/export rw,vers=4.1
+31 22 0:41 / /data2 rw,relatime shared:3 - fuse.glusterfs gfs1:/vol rw
+32 30 0:42 / /data/my\040share rw,relatime shared:4 - nfs 10.0.0.2:/share rw
+`
+	testCases := []struct {
+		desc       string
+		path       string
+		wantMount  string
+		wantFSType string
+	}{
+		{
+			desc:       "root",
+			path:       "/tmp/x",
+			wantMount:  "/",
+			wantFSType: "ext4",
+		},
+		{
+			desc:       "mount point itself",
+			path:       "/data",
+			wantMount:  "/data",
+			wantFSType: "nfs4",
+		},
+		{
+			desc:       "sibling with common prefix",
+			path:       "/data2/x",
+			wantMount:  "/data2",
+			wantFSType: "fuse.glusterfs",
+		},
+		{
+			desc:       "nested escaped mount",
+			path:       "/data/my share/x",
+			wantMount:  "/data/my share",
+			wantFSType: "nfs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			mi, err := parseMountInfo(strings.NewReader(mountInfo), tc.path)
+			if err != nil {
+				t.Fatalf("parse mount info error: %v", err)
+			}
+			if mi.MountPoint != tc.wantMount || mi.FSType != tc.wantFSType {
+				t.Fatalf("mount: %s %s, want: %s %s", mi.MountPoint, mi.FSType, tc.wantMount, tc.wantFSType)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"errors"
+)
+
+func findMount(path string) (*mountInfo, error) {
+	return nil, errors.New("mount detection is only supported on linux")
+}
+
+func statMount(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("mount statistics are only supported on linux")
+}
@@ -0,0 +1,120 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func withMount(t *testing.T, fsType string) {
+	lookup := lookupMount
+	lookupMount = func(path string) (*mountInfo, error) {
+		return &mountInfo{MountPoint: "/", FSType: fsType, Source: "server:/export"}, nil
+	}
+	t.Cleanup(func() { lookupMount = lookup })
+}
+
+func TestNewMountBlobStore(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		kind       Kind
+		fsType     string
+		config     map[string]string
+		expectsErr bool
+	}{
+		{
+			desc:   "nfs on nfs4",
+			kind:   KindNFS,
+			fsType: "nfs4",
+		},
+		{
+			desc:   "glusterfs on fuse",
+			kind:   KindGlusterFS,
+			fsType: "fuse.glusterfs",
+		},
+		{
+			desc:       "nfs on ext4",
+			kind:       KindNFS,
+			fsType:     "ext4",
+			expectsErr: true,
+		},
+		{
+			desc:   "cfs with custom fs types",
+			kind:   KindCFS,
+			fsType: "fuse.cfs",
+			config: map[string]string{ConfigFSTypes: "fuse.cfs"},
+		},
+		{
+			desc:       "invalid retries",
+			kind:       KindNFS,
+			fsType:     "nfs",
+			config:     map[string]string{ConfigRetries: "-1"},
+			expectsErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			withMount(t, tc.fsType)
+			bs, err := NewBlobStore(tc.kind, "./", tc.config)
+			if tc.expectsErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("new blob store error: %v", err)
+			}
+			health := bs.(MountHealthChecker).MountHealth()
+			if !health.Healthy || health.FSType != tc.fsType {
+				t.Fatalf("unexpected health: %+v", health)
+			}
+		})
+	}
+}
+
+func TestMountRetry(t *testing.T) {
+	withMount(t, "nfs")
+	bs, err := newMountBlobStore(KindNFS, "./", map[string]string{ConfigRetryInterval: "1ms"})
+	if err != nil {
+		t.Fatalf("new blob store error: %v", err)
+	}
+
+	calls := 0
+	err = bs.retry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &os.PathError{Op: "open", Path: "x", Err: syscall.ESTALE}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("retry stale handle: err %v, calls %d", err, calls)
+	}
+
+	calls = 0
+	err = bs.retry(context.Background(), func() error {
+		calls++
+		return syscall.ENOENT
+	})
+	if !errors.Is(err, syscall.ENOENT) || calls != 1 {
+		t.Fatalf("retry non transient error: err %v, calls %d", err, calls)
+	}
+
+	path := "my-bucket/mount-hello"
+	if err = bs.WriteRaw(path, strings.NewReader("hello world")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer bs.DeleteRaw(path)
+	meta, err := bs.GetMeta(path)
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	if meta.Size != 11 {
+		t.Fatalf("size: %d, want 11", meta.Size)
+	}
+}
@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteOptions what is stored along with the object, GetMeta returns the same values back
+type WriteOptions struct {
+	ContentType     string `json:"contentType,omitempty"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	CacheControl    string `json:"cacheControl,omitempty"`
+	// Metadata user defined metadata, keys are stored lower-cased like s3 does
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// StorageClass s3 storage class such as STANDARD_IA, other stores only persist it
+	StorageClass string `json:"storageClass,omitempty"`
+	// Checksum expected checksum of the content like "sha256:<base64>", see ChecksumAlgorithm.
+	// The write fails with a *ChecksumMismatchError when the stored bytes differ,
+	// s3 only checks it for uploads of a single part.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func (o WriteOptions) isZero() bool {
+	return o.ContentType == "" && o.ContentEncoding == "" && o.CacheControl == "" &&
+		len(o.Metadata) == 0 && o.StorageClass == "" && o.Checksum == ""
+}
+
+// normalize returns a copy with lower-cased metadata keys
+func (o WriteOptions) normalize() WriteOptions {
+	if len(o.Metadata) == 0 {
+		o.Metadata = nil
+		return o
+	}
+	metadata := make(map[string]string, len(o.Metadata))
+	for k, v := range o.Metadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	o.Metadata = metadata
+	return o
+}
+
+// apply fills meta with the stored options, detected values are kept when an option is empty
+func (o WriteOptions) apply(meta *BlobMeta) {
+	if o.ContentType != "" {
+		meta.ContentType = o.ContentType
+	}
+	meta.ContentEncoding = o.ContentEncoding
+	meta.CacheControl = o.CacheControl
+	meta.Metadata = o.Metadata
+	meta.StorageClass = o.StorageClass
+	if o.Checksum != "" {
+		meta.Checksum = o.Checksum
+	}
+}
+
+// OptionsWriter stores a raw byte stream together with WriteOptions
+type OptionsWriter interface {
+	WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error
+}
+
+// WriteRawWithOptions stores with the options if bs supports them, empty options fall back to WriteRaw
+func WriteRawWithOptions(bs BlobStore, path string, in io.Reader, opts WriteOptions) error {
+	if ow, ok := bs.(OptionsWriter); ok {
+		return ow.WriteRawWithOptions(path, in, opts)
+	}
+	if opts.isZero() {
+		return bs.WriteRaw(path, in)
+	}
+	return newBlobError("WriteRawWithOptions", path, fmt.Errorf("%w: blob store %T does not support write options", ErrUnsupported, bs))
+}
@@ -0,0 +1,177 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestWriteRawWithOptions(t *testing.T) {
+	opts := WriteOptions{
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		CacheControl:    "max-age=60",
+		Metadata:        map[string]string{"Owner": "team-a"},
+		StorageClass:    "STANDARD_IA",
+	}
+	wantMeta := BlobMeta{
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		CacheControl:    "max-age=60",
+		Metadata:        map[string]string{"owner": "team-a"},
+		StorageClass:    "STANDARD_IA",
+	}
+	path := "my-bucket/options"
+
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := bsSet[backend]
+		t.Run(backend, func(t *testing.T) {
+			if err := WriteRawWithOptions(bs, path, strings.NewReader(`{"hello":"world"}`), opts); err != nil {
+				t.Fatalf("write raw with options error: %v", err)
+			}
+			defer bs.DeleteRaw(path)
+
+			meta, err := bs.GetMeta(path)
+			if err != nil {
+				t.Fatalf("get meta error: %v", err)
+			}
+			if meta.ContentType != wantMeta.ContentType || meta.ContentEncoding != wantMeta.ContentEncoding ||
+				meta.CacheControl != wantMeta.CacheControl || meta.StorageClass != wantMeta.StorageClass ||
+				!reflect.DeepEqual(meta.Metadata, wantMeta.Metadata) {
+				t.Fatalf("get meta: %+v, want: %+v", *meta, wantMeta)
+			}
+
+			// a plain write drops the options of the previous write
+			if err = bs.WriteRaw(path, strings.NewReader("hello world")); err != nil {
+				t.Fatalf("write raw error: %v", err)
+			}
+			meta, err = bs.GetMeta(path)
+			if err != nil {
+				t.Fatalf("get meta error: %v", err)
+			}
+			if meta.ContentType == opts.ContentType || meta.Metadata != nil || meta.CacheControl != "" {
+				t.Fatalf("options survived a plain write: %+v", *meta)
+			}
+		})
+	}
+
+	wrapped := struct{ BlobStore }{bsSet[BlobStoreMem]}
+	err := WriteRawWithOptions(wrapped, path, strings.NewReader("hello world"), opts)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("write options through unsupported store: %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestLocalWriteOptionsSidecar(t *testing.T) {
+	// a filesystem without user xattrs
+	setXattr = func(fullPath string, opts WriteOptions) error { return syscall.ENOTSUP }
+	defer func() { setXattr = setXattrWriteOptions }()
+
+	bs, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	opts := WriteOptions{ContentType: "application/json", Metadata: map[string]string{"owner": "team-a"}}
+	if err = WriteRawWithOptions(bs, "dir/a", strings.NewReader(`{}`), opts); err != nil {
+		t.Fatalf("write raw with options error: %v", err)
+	}
+	meta, err := bs.GetMeta("dir/a")
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	if meta.ContentType != opts.ContentType || meta.Metadata["owner"] != "team-a" {
+		t.Fatalf("options of the sidecar: %+v", *meta)
+	}
+	fullPath, _ := bs.BuildURL("dir/a")
+	if _, err = os.Stat(localMetaPath(fullPath)); err != nil {
+		t.Fatalf("sidecar: %v", err)
+	}
+
+	// listings skip the sidecar
+	metas, err := bs.ListMeta("dir", ListMetaOption{})
+	if err != nil || names(metas) != "dir/a" {
+		t.Fatalf("list meta: %s %v", names(metas), err)
+	}
+	page, err := ListPage(bs, "dir", "", 10)
+	if err != nil || names(page.Metas) != "dir/a" {
+		t.Fatalf("list page: %+v %v", page, err)
+	}
+	var walked []string
+	err = Walk(bs, "dir", func(meta *BlobMeta, isDir bool, err error) error {
+		walked = append(walked, meta.Name)
+		return err
+	})
+	if err != nil || strings.Join(walked, ",") != "dir/a" {
+		t.Fatalf("walk: %v %v", walked, err)
+	}
+
+	// a plain write drops the sidecar, so does a delete
+	if err = bs.WriteRaw("dir/a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if meta, err = bs.GetMeta("dir/a"); err != nil || meta.Metadata != nil {
+		t.Fatalf("options survived a plain write: %+v %v", meta, err)
+	}
+	if err = WriteRawWithOptions(bs, "dir/a", strings.NewReader(`{}`), opts); err != nil {
+		t.Fatalf("write raw with options error: %v", err)
+	}
+	if err = bs.DeleteRaw("dir/a"); err != nil {
+		t.Fatalf("delete raw error: %v", err)
+	}
+	if _, err = os.Stat(localMetaPath(fullPath)); !os.IsNotExist(err) {
+		t.Fatalf("sidecar after delete: %v", err)
+	}
+}
+
+func TestLocalWriteOptionsSidecarFailedCommit(t *testing.T) {
+	setXattr = func(fullPath string, opts WriteOptions) error { return syscall.ENOTSUP }
+	defer func() { setXattr = setXattrWriteOptions }()
+
+	bs, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+	opts := WriteOptions{ContentType: "application/json", Metadata: map[string]string{"owner": "team-a"}}
+	if err = WriteRawWithOptions(bs, "a", strings.NewReader(`{}`), opts); err != nil {
+		t.Fatalf("write raw with options error: %v", err)
+	}
+
+	// the temp file is gone before the rename, the commit fails
+	setXattr = func(tempPath string, opts WriteOptions) error {
+		os.Remove(tempPath)
+		return syscall.ENOTSUP
+	}
+	err = WriteRawWithOptions(bs, "a", strings.NewReader(`[]`), WriteOptions{ContentType: "text/plain"})
+	if err == nil {
+		t.Fatalf("write raw with a failed commit succeeded")
+	}
+	meta, err := bs.GetMeta("a")
+	if err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	if meta.ContentType != opts.ContentType || meta.Metadata["owner"] != "team-a" {
+		t.Fatalf("options after a failed commit: %+v", *meta)
+	}
+}
+
+func TestNewUploadInput(t *testing.T) {
+	input := newUploadInput("my-bucket", "hello", strings.NewReader(""), WriteOptions{
+		ContentType:  "text/plain",
+		Metadata:     map[string]string{"Owner": "team-a"},
+		StorageClass: "GLACIER",
+	})
+	if aws.StringValue(input.ContentType) != "text/plain" || aws.StringValue(input.StorageClass) != "GLACIER" {
+		t.Fatalf("unexpected upload input: %v", input)
+	}
+	if input.ContentEncoding != nil || input.CacheControl != nil {
+		t.Fatalf("empty options should not be sent: %v", input)
+	}
+	if aws.StringValue(input.Metadata["owner"]) != "team-a" {
+		t.Fatalf("metadata: %v", aws.StringValueMap(input.Metadata))
+	}
+}
@@ -0,0 +1,110 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+// MetaPage one page of a recursive listing
+type MetaPage struct {
+	Metas []*BlobMeta `json:"metas"`
+	// NextCursor pass it to the next ListPage call, empty if the listing is complete
+	NextCursor string `json:"nextCursor"`
+	// IsTruncated more metas exist after this page
+	IsTruncated bool `json:"isTruncated"`
+}
+
+// Pager lists all objects below path page by page, in a stable order.
+// cursor is empty for the first page, limit <= 0 or > MaxKeys means MaxKeys.
+type Pager interface {
+	ListPage(path, cursor string, limit int64) (*MetaPage, error)
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// ContextPager a Pager whose listing stops when ctx is done
+type ContextPager interface {
+	ListPageWithContext(ctx context.Context, path, cursor string, limit int64) (*MetaPage, error)
+}
+
+// ListPage uses the native paging of bs, stores without it are listed with ListMeta and sliced
+func ListPage(bs BlobStore, path, cursor string, limit int64) (*MetaPage, error) {
+	return ListPageWithContext(context.Background(), bs, path, cursor, limit)
+}
+
+// ListPageWithContext is ListPage stopping when ctx is done
+func ListPageWithContext(ctx context.Context, bs BlobStore, path, cursor string, limit int64) (*MetaPage, error) {
+	if pager, ok := bs.(ContextPager); ok {
+		return pager.ListPageWithContext(ctx, path, cursor, limit)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if pager, ok := bs.(Pager); ok {
+		return pager.ListPage(path, cursor, limit)
+	}
+	offset := 0
+	if cursor != "" {
+		v, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return nil, errInvalidCursor
+		}
+	}
+	metas, err := WithContext(bs).ListMetaWithContext(ctx, path, ListMetaOption{})
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(metas) {
+		offset = len(metas)
+	}
+	end := offset + int(pageLimit(limit))
+	page := &MetaPage{Metas: metas[offset:]}
+	if end < len(metas) {
+		page.Metas = metas[offset:end]
+		page.NextCursor = encodeCursor(strconv.Itoa(end))
+		page.IsTruncated = true
+	}
+	return page, nil
+}
+
+// ListAll walks all pages of path
+func ListAll(bs BlobStore, path string) ([]*BlobMeta, error) {
+	metas := make([]*BlobMeta, 0)
+	cursor := ""
+	for {
+		page, err := ListPage(bs, path, cursor, MaxKeys)
+		if err != nil {
+			return metas, err
+		}
+		metas = append(metas, page.Metas...)
+		if !page.IsTruncated {
+			return metas, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func pageLimit(limit int64) int64 {
+	if limit <= 0 || limit > MaxKeys {
+		return MaxKeys
+	}
+	return limit
+}
+
+// encodeCursor cursors are opaque to callers, they should not build them from object names
+func encodeCursor(v string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	v, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errInvalidCursor
+	}
+	return string(v), nil
+}
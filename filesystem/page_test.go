@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListPage(t *testing.T) {
+	files := []string{"a/1", "a/b/2", "a/b.txt", "a/b/c/3", "a/d", "e"}
+	root := "my-bucket/page"
+	stores := newTestBlobStores(t)
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := stores[backend]
+		for _, file := range files {
+			if err := bs.WriteRaw(root+"/"+file, strings.NewReader(file)); err != nil {
+				t.Fatalf("write raw error: %v", err)
+			}
+			defer bs.DeleteRaw(root + "/" + file)
+		}
+
+		testCases := []struct {
+			desc string
+			bs   BlobStore
+		}{
+			{
+				desc: backend + " native",
+				bs:   bs,
+			},
+			{
+				desc: backend + " fallback",
+				bs:   struct{ BlobStore }{bs},
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				want, err := tc.bs.ListMeta(root, ListMetaOption{})
+				if err != nil {
+					t.Fatalf("list meta error: %v", err)
+				}
+				if len(want) != len(files) {
+					t.Fatalf("list %d metas, want %d", len(want), len(files))
+				}
+
+				got := make([]*BlobMeta, 0)
+				cursor := ""
+				for pages := 1; ; pages++ {
+					page, err := ListPage(tc.bs, root, cursor, 4)
+					if err != nil {
+						t.Fatalf("list page error: %v", err)
+					}
+					got = append(got, page.Metas...)
+					if !page.IsTruncated {
+						if pages != 2 || page.NextCursor != "" {
+							t.Fatalf("last page %d, next cursor %q", pages, page.NextCursor)
+						}
+						break
+					}
+					cursor = page.NextCursor
+				}
+				if names(got) != names(want) {
+					t.Fatalf("paged names: %s, want: %s", names(got), names(want))
+				}
+
+				all, err := ListAll(tc.bs, root)
+				if err != nil {
+					t.Fatalf("list all error: %v", err)
+				}
+				if names(all) != names(want) {
+					t.Fatalf("all names: %s, want: %s", names(all), names(want))
+				}
+			})
+		}
+	}
+}
+
+func TestListPageInvalidCursor(t *testing.T) {
+	for backend, bs := range bsSet {
+		if _, ok := bs.(Pager); !ok || backend == BlobStoreMinio {
+			continue
+		}
+		if _, err := ListPage(bs, "", "!not-base64!", 1); err == nil {
+			t.Fatalf("backend %s: list page with invalid cursor should fail", backend)
+		}
+	}
+}
+
+func names(metas []*BlobMeta) string {
+	s := make([]string, len(metas))
+	for i, meta := range metas {
+		s[i] = meta.Name
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,141 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// RangeReader reads length bytes of path starting at offset, length < 0 reads to the end.
+// The stream is empty if offset is at or beyond the end of the object.
+type RangeReader interface {
+	ReadRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+var errNegativeOffset = errors.New("negative offset")
+
+// ReadRange uses the native ranged read of bs, other stores read and discard the bytes before offset
+func ReadRange(bs BlobStore, path string, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := bs.(RangeReader); ok {
+		return rr.ReadRange(path, offset, length)
+	}
+	if offset < 0 {
+		return nil, errNegativeOffset
+	}
+	rc, err := bs.ReadRaw(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.CopyN(ioutil.Discard, rc, offset); err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	return limitReadCloser(rc, length), nil
+}
+
+// limitReadCloser length < 0 means no limit
+func limitReadCloser(rc io.ReadCloser, length int64) io.ReadCloser {
+	if length < 0 {
+		return rc
+	}
+	return &readCloser{Reader: io.LimitReader(rc, length), Closer: rc}
+}
+
+// BlobReader random access to an object through ReadRange.
+// Read and Seek share one offset and keep a stream open until the offset jumps,
+// ReadAt is independent of them and safe for concurrent use.
+type BlobReader struct {
+	bs     BlobStore
+	path   string
+	size   int64
+	offset int64
+	stream io.ReadCloser
+}
+
+var (
+	_ io.ReaderAt   = &BlobReader{}
+	_ io.ReadSeeker = &BlobReader{}
+	_ io.Closer     = &BlobReader{}
+)
+
+// NewBlobReader the object size is fetched once with GetMeta
+func NewBlobReader(bs BlobStore, path string) (*BlobReader, error) {
+	meta, err := bs.GetMeta(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobReader{bs: bs, path: path, size: meta.Size}, nil
+}
+
+func (r *BlobReader) Size() int64 {
+	return r.size
+}
+
+func (r *BlobReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	length := int64(len(p))
+	if off+length > r.size {
+		length = r.size - off
+	}
+	rc, err := ReadRange(r.bs, r.path, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.ReadFull(rc, p[:length])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *BlobReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.stream == nil {
+		rc, err := ReadRange(r.bs, r.path, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.stream = rc
+	}
+	n, err := r.stream.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	if offset != r.offset && r.stream != nil {
+		r.stream.Close()
+		r.stream = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *BlobReader) Close() error {
+	if r.stream == nil {
+		return nil
+	}
+	err := r.stream.Close()
+	r.stream = nil
+	return err
+}
@@ -0,0 +1,120 @@
+package filesystem
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	content := "0123456789"
+	path := "my-bucket/range"
+	testCases := []struct {
+		desc       string
+		offset     int64
+		length     int64
+		want       string
+		expectsErr bool
+	}{
+		{
+			desc:   "head",
+			offset: 0,
+			length: 4,
+			want:   "0123",
+		},
+		{
+			desc:   "to the end",
+			offset: 3,
+			length: -1,
+			want:   "3456789",
+		},
+		{
+			desc:   "length beyond the end",
+			offset: 8,
+			length: 5,
+			want:   "89",
+		},
+		{
+			desc:   "offset beyond the end",
+			offset: 20,
+			length: 2,
+			want:   "",
+		},
+		{
+			desc:       "negative offset",
+			offset:     -1,
+			length:     2,
+			expectsErr: true,
+		},
+	}
+
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := bsSet[backend]
+		if err := bs.WriteRaw(path, strings.NewReader(content)); err != nil {
+			t.Fatalf("write raw error: %v", err)
+		}
+		defer bs.DeleteRaw(path)
+
+		for _, tc := range testCases {
+			for _, rangeBS := range []BlobStore{bs, struct{ BlobStore }{bs}} {
+				t.Run(backend+" "+tc.desc, func(t *testing.T) {
+					rc, err := ReadRange(rangeBS, path, tc.offset, tc.length)
+					if tc.expectsErr {
+						if err == nil {
+							t.Fatal("want error, got nil")
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("read range error: %v", err)
+					}
+					defer rc.Close()
+					got, err := ioutil.ReadAll(rc)
+					if err != nil {
+						t.Fatalf("read error: %v", err)
+					}
+					if string(got) != tc.want {
+						t.Fatalf("content: %s, want: %s", got, tc.want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestBlobReader(t *testing.T) {
+	bs := bsSet[BlobStoreMem]
+	path := "my-bucket/blob-reader"
+	if err := bs.WriteRaw(path, strings.NewReader("0123456789")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer bs.DeleteRaw(path)
+
+	r, err := NewBlobReader(bs, path)
+	if err != nil {
+		t.Fatalf("new blob reader error: %v", err)
+	}
+	defer r.Close()
+
+	p := make([]byte, 4)
+	if n, err := r.ReadAt(p, 7); n != 3 || err != io.EOF || string(p[:n]) != "789" {
+		t.Fatalf("read at tail: %d %v %q", n, err, p[:n])
+	}
+	if n, err := r.ReadAt(p, 2); n != 4 || err != nil || string(p) != "2345" {
+		t.Fatalf("read at: %d %v %q", n, err, p)
+	}
+
+	if _, err = r.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatalf("seek error: %v", err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || string(rest) != "789" {
+		t.Fatalf("read after seek: %q %v", rest, err)
+	}
+
+	section, err := ioutil.ReadAll(io.NewSectionReader(r, 1, 3))
+	if err != nil || string(section) != "123" {
+		t.Fatalf("section read: %q %v", section, err)
+	}
+}
@@ -0,0 +1,284 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimits of a Limiter, zero values are unlimited
+type RateLimits struct {
+	// BytesPerSecond of the streams read and written, shared by every operation
+	BytesPerSecond int64
+	// Default limit of the operations missing from Operations
+	Default OperationLimit
+	// Operations per operation, keyed by the method name, e.g. "ReadRaw" or "ListMeta"
+	Operations map[string]OperationLimit
+}
+
+// OperationLimit limits the calls of an operation
+type OperationLimit struct {
+	RequestsPerSecond float64
+	// MaxInFlight concurrent calls, a stream read stays in flight until it is closed
+	MaxInFlight int
+}
+
+func (l RateLimits) operation(op string) OperationLimit {
+	if limit, ok := l.Operations[op]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// Limiter enforces RateLimits on the stores wrapped by WithRateLimit,
+// the stores sharing a Limiter share its limits.
+type Limiter struct {
+	mu     sync.Mutex
+	limits RateLimits
+	bytes  tokenBucket
+	ops    map[string]*operationLimiter
+	now    func() time.Time
+}
+
+type operationLimiter struct {
+	requests tokenBucket
+	inFlight int
+	// released is closed when a call leaves or the limits change
+	released chan struct{}
+}
+
+// NewLimiter returns a Limiter enforcing limits
+func NewLimiter(limits RateLimits) *Limiter {
+	l := &Limiter{ops: make(map[string]*operationLimiter), now: time.Now}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits changes the limits. Calls waiting for an in flight slot re-check the new MaxInFlight,
+// calls already sleeping on a request or byte reservation finish that wait at the old rate.
+func (l *Limiter) SetLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.limits = limits
+	l.bytes.setRate(now, float64(limits.BytesPerSecond), float64(limits.BytesPerSecond))
+	for op, o := range l.ops {
+		rps := limits.operation(op).RequestsPerSecond
+		o.requests.setRate(now, rps, requestBurst(rps))
+		close(o.released)
+		o.released = make(chan struct{})
+	}
+}
+
+// Limits the current limits
+func (l *Limiter) Limits() RateLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// requestBurst a second worth of requests, at least one
+func requestBurst(rps float64) float64 {
+	if rps < 1 {
+		return 1
+	}
+	return rps
+}
+
+func (l *Limiter) operation(op string) *operationLimiter {
+	o, ok := l.ops[op]
+	if !ok {
+		o = &operationLimiter{released: make(chan struct{})}
+		rps := l.limits.operation(op).RequestsPerSecond
+		o.requests.setRate(l.now(), rps, requestBurst(rps))
+		l.ops[op] = o
+	}
+	return o
+}
+
+// acquire waits for an in flight slot then for the request rate of op, release must be called once done
+func (l *Limiter) acquire(ctx context.Context, op string) error {
+	for {
+		l.mu.Lock()
+		o := l.operation(op)
+		limit := l.limits.operation(op)
+		if limit.MaxInFlight <= 0 || o.inFlight < limit.MaxInFlight {
+			o.inFlight++
+			wait := o.requests.reserve(l.now(), 1)
+			l.mu.Unlock()
+			if err := sleepContext(ctx, wait); err != nil {
+				l.release(op)
+				return err
+			}
+			return nil
+		}
+		released := o.released
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (l *Limiter) release(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	o := l.operation(op)
+	o.inFlight--
+	close(o.released)
+	o.released = make(chan struct{})
+}
+
+// waitBytes paces n bytes already transferred
+func (l *Limiter) waitBytes(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	wait := l.bytes.reserve(l.now(), float64(n))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, wait)
+}
+
+// tokenBucket refills rate tokens per second up to burst. A reservation larger than the tokens
+// left is granted on credit, the caller waits until the debt is refilled.
+type tokenBucket struct {
+	// rate 0 is unlimited
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) setRate(now time.Time, rate, burst float64) {
+	if rate <= 0 {
+		b.rate = 0
+		return
+	}
+	if b.rate <= 0 {
+		// from unlimited, start full
+		b.tokens = burst
+	} else {
+		b.advance(now)
+	}
+	b.rate, b.burst, b.last = rate, burst, now
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// reserve takes n tokens and returns the wait before they are available
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.advance(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// WithRateLimit returns bs limited by l. The bytes of the read and written streams and of DownloadAt
+// are paced, server side copies only count as requests.
+func WithRateLimit(bs BlobStore, l *Limiter) BlobStore {
+	return &wrappedBlobStore{inner: bs, mw: l}
+}
+
+var _ middleware = &Limiter{}
+
+func (l *Limiter) call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error {
+	if err := l.acquire(ctx, op); err != nil {
+		return err
+	}
+	defer l.release(op)
+	return fn(ctx)
+}
+
+func (l *Limiter) read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if err := l.acquire(ctx, op); err != nil {
+		return nil, err
+	}
+	rc, err := fn(ctx)
+	if err != nil {
+		l.release(op)
+		return nil, err
+	}
+	return &limitedReadCloser{limitedReader: limitedReader{ctx: ctx, r: rc, limiter: l}, closer: rc, op: op}, nil
+}
+
+func (l *Limiter) write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error {
+	if err := l.acquire(ctx, op); err != nil {
+		return err
+	}
+	defer l.release(op)
+	return fn(ctx, hookReader(in, func(n int) error { return l.waitBytes(ctx, n) }, nil))
+}
+
+func (l *Limiter) download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error) {
+	if err := l.acquire(ctx, op); err != nil {
+		return 0, err
+	}
+	defer l.release(op)
+	return fn(ctx, &limitedWriterAt{ctx: ctx, w: wa, limiter: l})
+}
+
+// limitedReader paces the bytes read from r
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if waitErr := r.limiter.waitBytes(r.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// limitedReadCloser leaves the in flight calls of op once closed
+type limitedReadCloser struct {
+	limitedReader
+	closer io.Closer
+	op     string
+	once   sync.Once
+}
+
+func (r *limitedReadCloser) Close() error {
+	r.once.Do(func() { r.limiter.release(r.op) })
+	return r.closer.Close()
+}
+
+// limitedWriterAt paces the bytes written to w
+type limitedWriterAt struct {
+	ctx     context.Context
+	w       io.WriterAt
+	limiter *Limiter
+}
+
+func (w *limitedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.w.WriteAt(p, off)
+	if waitErr := w.limiter.waitBytes(w.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
@@ -0,0 +1,134 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	var b tokenBucket
+	if wait := b.reserve(now, 100); wait != 0 {
+		t.Fatalf("unlimited wait: %v", wait)
+	}
+	b.setRate(now, 10, 10)
+	if wait := b.reserve(now, 10); wait != 0 {
+		t.Fatalf("wait within the burst: %v", wait)
+	}
+	if wait := b.reserve(now, 5); wait != 500*time.Millisecond {
+		t.Fatalf("wait on credit: %v, want 500ms", wait)
+	}
+	// the debt is refilled first
+	if wait := b.reserve(now.Add(time.Second), 5); wait != 0 {
+		t.Fatalf("wait after the refill: %v", wait)
+	}
+	b.setRate(now.Add(time.Second), 0, 0)
+	if wait := b.reserve(now.Add(time.Second), 1000); wait != 0 {
+		t.Fatalf("wait after removing the limit: %v", wait)
+	}
+}
+
+func TestWithRateLimitInFlight(t *testing.T) {
+	limiter := NewLimiter(RateLimits{Operations: map[string]OperationLimit{"ReadRaw": {MaxInFlight: 1}}})
+	mem := newTestMemBlobStore(t, "a", "b")
+	// the stores share the limits of the limiter
+	bs1, bs2 := WithRateLimit(mem, limiter), WithRateLimit(mem, limiter)
+
+	stream, err := bs1.ReadRaw("a")
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = WithContext(bs2).ReadRawWithContext(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("read raw over the in flight limit: %v, want %v", err, context.DeadlineExceeded)
+	}
+	// other operations are not limited
+	if _, err = bs2.GetMeta("b"); err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		stream, err := bs2.ReadRaw("b")
+		if err == nil {
+			err = stream.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		t.Fatalf("read raw did not wait for the open stream: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	// raising the limit lets the waiting call in
+	limiter.SetLimits(RateLimits{Operations: map[string]OperationLimit{"ReadRaw": {MaxInFlight: 2}}})
+	if err = <-done; err != nil {
+		t.Fatalf("read raw after raising the limit: %v", err)
+	}
+	stream.Close()
+	if got := limiter.Limits().Operations["ReadRaw"].MaxInFlight; got != 2 {
+		t.Fatalf("max in flight: %d, want 2", got)
+	}
+}
+
+func TestWithRateLimitBytes(t *testing.T) {
+	content := strings.Repeat("x", 12000)
+	bs := WithRateLimit(newTestMemBlobStore(t), NewLimiter(RateLimits{BytesPerSecond: 10000}))
+
+	start := time.Now()
+	if err := bs.WriteRaw("a", strings.NewReader(content)); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	// the first second is the burst
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("write of 12000 bytes at 10000 bytes/s took %v", elapsed)
+	}
+
+	start = time.Now()
+	stream, err := bs.ReadRaw("a")
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	defer stream.Close()
+	if got, err := ioutil.ReadAll(stream); err != nil || string(got) != content {
+		t.Fatalf("read %d bytes: %v", len(got), err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("read of 12000 bytes after the burst took %v", elapsed)
+	}
+}
+
+func TestWithRateLimitRequests(t *testing.T) {
+	bs := WithRateLimit(newTestMemBlobStore(t, "a"), NewLimiter(RateLimits{Default: OperationLimit{RequestsPerSecond: 20}}))
+	start := time.Now()
+	// 20 requests are the burst
+	for i := 0; i < 22; i++ {
+		if _, err := bs.GetMeta("a"); err != nil {
+			t.Fatalf("get meta error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("22 requests at 20 requests/s took %v", elapsed)
+	}
+}
+
+func TestWithRateLimitResumable(t *testing.T) {
+	s, fake, journalDir := newTestResumableStore(t)
+	s.transfer.concurrency = 1
+	data := make([]byte, 3*1024)
+	fake.failPart = 2
+	bs := WithRateLimit(s, NewLimiter(RateLimits{}))
+	if err := bs.WriteRaw("big", bytes.NewReader(data)); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	if journals, _ := filepath.Glob(filepath.Join(journalDir, "*.json")); len(journals) != 1 {
+		t.Fatalf("journals of a seekable write: %v", journals)
+	}
+}
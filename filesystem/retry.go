@@ -0,0 +1,283 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RetryPolicy exponential backoff between the attempts of an operation
+type RetryPolicy struct {
+	// MaxAttempts including the first call, 1 disables the retries
+	MaxAttempts int
+	// InitialBackoff the backoff before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after each retry
+	Multiplier float64
+}
+
+// DefaultRetryPolicy the policy of the operations without one in RetryOptions
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	return p
+}
+
+// backoff before the retry-th retry, half of it is jitter so concurrent callers spread out
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// defaultRetryBuffer writes of readers that cannot seek are buffered up to this size
+const defaultRetryBuffer = 8 << 20
+
+// RetryOptions of WithRetry
+type RetryOptions struct {
+	// Policy of the operations missing from Policies, zero fields use DefaultRetryPolicy
+	Policy RetryPolicy
+	// Policies per operation, keyed by the method name, e.g. "WriteRaw" or "CopyRawFrom"
+	Policies map[string]RetryPolicy
+	// Retryable classifies the errors, defaults to IsRetryable
+	Retryable func(err error) bool
+	// BufferSize writes of readers that cannot seek are buffered up to this size to be retried,
+	// larger ones are written once. 0 uses 8MiB, a negative size disables the buffering.
+	BufferSize int64
+}
+
+// RetryStats counters of the retried calls of an operation
+type RetryStats struct {
+	Calls   int64
+	Retries int64
+	// Exhausted calls failing with a retryable error after the last attempt
+	Exhausted int64
+}
+
+// RetryReporter is implemented by the stores returned by WithRetry
+type RetryReporter interface {
+	// RetryStats the counters keyed by operation
+	RetryStats() map[string]RetryStats
+}
+
+// IsRetryable reports whether err is likely transient: throttling, timeouts, connection resets,
+// 5xx responses and the stale handles of a mount. Context errors are never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrThrottled) {
+		return true
+	}
+	if kind := classifyError(err); kind != nil {
+		return false
+	}
+	if isTransientMountError(err) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// aws errors do not implement Unwrap
+	var aErr awserr.Error
+	if !errors.As(err, &aErr) {
+		return false
+	}
+	switch aErr.Code() {
+	case "RequestTimeout", "RequestTimeoutException", "InternalError", "ServiceUnavailable",
+		request.ErrCodeRequestError, request.ErrCodeRead, request.ErrCodeResponseTimeout:
+		return true
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	return aErr.OrigErr() != nil && IsRetryable(aErr.OrigErr())
+}
+
+// WithRetry returns bs retrying the calls failing with a retryable error.
+// Reads only retry opening the stream, writes are retried when the reader can seek or was buffered
+// and Walk is never retried as fn would see the same entries again.
+// The returned store implements RetryReporter.
+func WithRetry(bs BlobStore, opts RetryOptions) BlobStore {
+	r := &retrier{opts: opts, stats: make(map[string]*RetryStats)}
+	if r.opts.Retryable == nil {
+		r.opts.Retryable = IsRetryable
+	}
+	if r.opts.BufferSize == 0 {
+		r.opts.BufferSize = defaultRetryBuffer
+	}
+	return &retryBlobStore{wrappedBlobStore: &wrappedBlobStore{inner: bs, mw: r}, retrier: r}
+}
+
+type retryBlobStore struct {
+	*wrappedBlobStore
+	retrier *retrier
+}
+
+var _ RetryReporter = &retryBlobStore{}
+
+func (r *retryBlobStore) RetryStats() map[string]RetryStats {
+	return r.retrier.statsSnapshot()
+}
+
+// retrier the middleware of WithRetry
+type retrier struct {
+	opts RetryOptions
+
+	mu    sync.Mutex
+	stats map[string]*RetryStats
+}
+
+var _ middleware = &retrier{}
+
+func (r *retrier) policy(op string) RetryPolicy {
+	if op == opWalk {
+		return RetryPolicy{MaxAttempts: 1}.normalize()
+	}
+	if p, ok := r.opts.Policies[op]; ok {
+		return p.normalize()
+	}
+	return r.opts.Policy.normalize()
+}
+
+func (r *retrier) count(op string, fn func(stats *RetryStats)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.stats[op]
+	if !ok {
+		stats = &RetryStats{}
+		r.stats[op] = stats
+	}
+	fn(stats)
+}
+
+func (r *retrier) statsSnapshot() map[string]RetryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := make(map[string]RetryStats, len(r.stats))
+	for op, stats := range r.stats {
+		snapshot[op] = *stats
+	}
+	return snapshot
+}
+
+func (r *retrier) call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error {
+	return r.retry(ctx, op, r.policy(op), fn)
+}
+
+func (r *retrier) retry(ctx context.Context, op string, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	r.count(op, func(stats *RetryStats) { stats.Calls++ })
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !r.opts.Retryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			r.count(op, func(stats *RetryStats) { stats.Exhausted++ })
+			return err
+		}
+		r.count(op, func(stats *RetryStats) { stats.Retries++ })
+		if err = sleepContext(ctx, policy.backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *retrier) read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := r.call(ctx, op, path, func(ctx context.Context) (err error) {
+		rc, err = fn(ctx)
+		return err
+	})
+	return rc, err
+}
+
+// download a failed download is written again at the same offsets
+func (r *retrier) download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error) {
+	var n int64
+	err := r.call(ctx, op, path, func(ctx context.Context) (err error) {
+		n, err = fn(ctx, wa)
+		return err
+	})
+	return n, err
+}
+
+// write rewinds a reader that can seek before each attempt, other readers are buffered when they fit
+func (r *retrier) write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error {
+	policy := r.policy(op)
+	if policy.MaxAttempts <= 1 {
+		return r.retry(ctx, op, policy, func(ctx context.Context) error { return fn(ctx, in) })
+	}
+	if seeker, ok := in.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return r.retryFrom(ctx, op, policy, in, seeker, start, fn)
+		}
+	}
+	if r.opts.BufferSize < 0 {
+		return r.retry(ctx, op, RetryPolicy{MaxAttempts: 1}, func(ctx context.Context) error { return fn(ctx, in) })
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(in, r.opts.BufferSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) > r.opts.BufferSize {
+		// too large to be buffered, the bytes already read are replayed once
+		in = io.MultiReader(bytes.NewReader(buf), in)
+		return r.retry(ctx, op, RetryPolicy{MaxAttempts: 1}, func(ctx context.Context) error { return fn(ctx, in) })
+	}
+	buffered := bytes.NewReader(buf)
+	return r.retryFrom(ctx, op, policy, buffered, buffered, 0, fn)
+}
+
+func (r *retrier) retryFrom(ctx context.Context, op string, policy RetryPolicy, in io.Reader, seeker io.Seeker, start int64,
+	fn func(ctx context.Context, in io.Reader) error) error {
+	first := true
+	return r.retry(ctx, op, policy, func(ctx context.Context) error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return fn(ctx, in)
+	})
+}
@@ -0,0 +1,200 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// flakyBlobStore fails the first calls of GetMeta and WriteRaw, WriteRaw consumes in before failing
+type flakyBlobStore struct {
+	BlobStore
+	err      error
+	failures int
+	calls    int
+}
+
+func (bs *flakyBlobStore) GetMeta(path string) (*BlobMeta, error) {
+	if bs.calls++; bs.calls <= bs.failures {
+		return nil, bs.err
+	}
+	return bs.BlobStore.GetMeta(path)
+}
+
+func (bs *flakyBlobStore) WriteRaw(path string, in io.Reader) error {
+	if bs.calls++; bs.calls <= bs.failures {
+		ioutil.ReadAll(in)
+		return bs.err
+	}
+	return bs.BlobStore.WriteRaw(path, in)
+}
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "throttled", err: newS3Error("GetMeta", "a", awserr.New("SlowDown", "slow down", nil)), want: true},
+		{desc: "5xx", err: newS3Error("GetMeta", "a", awserr.NewRequestFailure(awserr.New("Boom", "", nil), 502, "id")), want: true},
+		{desc: "connection reset", err: newS3Error("GetMeta", "a", awserr.New("RequestError", "send request failed", syscall.ECONNRESET)), want: true},
+		{desc: "eio", err: newBlobError("ReadRaw", "a", syscall.EIO), want: true},
+		{desc: "net timeout", err: &net.OpError{Op: "read", Err: &timeoutError{}}, want: true},
+		{desc: "not found", err: newS3Error("GetMeta", "a", awserr.New("NoSuchKey", "", nil)), want: false},
+		{desc: "4xx", err: newS3Error("GetMeta", "a", awserr.NewRequestFailure(awserr.New("BadRequest", "", nil), 400, "id")), want: false},
+		{desc: "permission", err: newBlobError("WriteRaw", "a", syscall.EACCES), want: false},
+		{desc: "canceled", err: fmt.Errorf("read: %w", context.Canceled), want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := IsRetryable(tc.err); got != tc.want {
+				t.Fatalf("retryable %v: %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}.normalize()
+	for retry, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		got := policy.backoff(retry + 1)
+		if got < want/2 || got > want {
+			t.Fatalf("backoff of retry %d: %v, want within [%v, %v]", retry+1, got, want/2, want)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	throttled := newS3Error("GetMeta", "a", awserr.New("SlowDown", "slow down", nil))
+	testCases := []struct {
+		desc      string
+		err       error
+		failures  int
+		wantCalls int
+		wantErr   error
+		wantStats RetryStats
+	}{
+		{desc: "recovers", err: throttled, failures: 2, wantCalls: 3, wantStats: RetryStats{Calls: 1, Retries: 2}},
+		{desc: "exhausted", err: throttled, failures: 3, wantCalls: 3, wantErr: ErrThrottled, wantStats: RetryStats{Calls: 1, Retries: 2, Exhausted: 1}},
+		{desc: "not retryable", err: ErrPermission, failures: 1, wantCalls: 1, wantErr: ErrPermission, wantStats: RetryStats{Calls: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flaky := &flakyBlobStore{BlobStore: newTestMemBlobStore(t, "a"), err: tc.err, failures: tc.failures}
+			bs := WithRetry(flaky, RetryOptions{Policy: testRetryPolicy})
+			_, err := bs.GetMeta("a")
+			if tc.wantErr == nil && err != nil || !errors.Is(err, tc.wantErr) {
+				t.Fatalf("get meta error: %v, want %v", err, tc.wantErr)
+			}
+			if flaky.calls != tc.wantCalls {
+				t.Fatalf("calls: %d, want %d", flaky.calls, tc.wantCalls)
+			}
+			if stats := bs.(RetryReporter).RetryStats()["GetMeta"]; stats != tc.wantStats {
+				t.Fatalf("stats: %+v, want %+v", stats, tc.wantStats)
+			}
+		})
+	}
+}
+
+func TestWithRetryPolicies(t *testing.T) {
+	flaky := &flakyBlobStore{BlobStore: newTestMemBlobStore(t, "a"), err: ErrThrottled, failures: 1}
+	bs := WithRetry(flaky, RetryOptions{Policy: testRetryPolicy, Policies: map[string]RetryPolicy{"GetMeta": {MaxAttempts: 1}}})
+	if _, err := bs.GetMeta("a"); !errors.Is(err, ErrThrottled) || flaky.calls != 1 {
+		t.Fatalf("get meta: %v after %d calls, want a single call", err, flaky.calls)
+	}
+	if err := bs.WriteRaw("b", strings.NewReader("b")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+}
+
+func TestWithRetryWrite(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		in         func() io.Reader
+		bufferSize int64
+		wantCalls  int
+		wantErr    error
+	}{
+		{desc: "seeker", in: func() io.Reader { return strings.NewReader("hello") }, wantCalls: 2},
+		{desc: "buffered", in: func() io.Reader { return ioutil.NopCloser(strings.NewReader("hello")) }, wantCalls: 2},
+		{desc: "too large to buffer", in: func() io.Reader { return ioutil.NopCloser(strings.NewReader("hello")) }, bufferSize: 4, wantCalls: 1, wantErr: ErrThrottled},
+		{desc: "buffering disabled", in: func() io.Reader { return ioutil.NopCloser(strings.NewReader("hello")) }, bufferSize: -1, wantCalls: 1, wantErr: ErrThrottled},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			flaky := &flakyBlobStore{BlobStore: newTestMemBlobStore(t), err: ErrThrottled, failures: 1}
+			bs := WithRetry(flaky, RetryOptions{Policy: testRetryPolicy, BufferSize: tc.bufferSize})
+			err := bs.WriteRaw("a", tc.in())
+			if !errors.Is(err, tc.wantErr) || tc.wantErr == nil && err != nil {
+				t.Fatalf("write raw error: %v, want %v", err, tc.wantErr)
+			}
+			if flaky.calls != tc.wantCalls {
+				t.Fatalf("calls: %d, want %d", flaky.calls, tc.wantCalls)
+			}
+			if err != nil {
+				return
+			}
+			out, err := bs.ReadRaw("a")
+			if err != nil {
+				t.Fatalf("read raw error: %v", err)
+			}
+			defer out.Close()
+			if content, _ := ioutil.ReadAll(out); string(content) != "hello" {
+				t.Fatalf("content: %q, want the whole input after the retry", content)
+			}
+		})
+	}
+}
+
+func TestWithRetryCanceled(t *testing.T) {
+	flaky := &flakyBlobStore{BlobStore: newTestMemBlobStore(t, "a"), err: ErrThrottled, failures: 10}
+	bs := WithRetry(flaky, RetryOptions{Policy: RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := WithContext(bs).GetMetaWithContext(ctx, "a")
+	if !errors.Is(err, context.DeadlineExceeded) || flaky.calls != 1 {
+		t.Fatalf("get meta: %v after %d calls, want %v", err, flaky.calls, context.DeadlineExceeded)
+	}
+}
+
+func TestWithRetryCopy(t *testing.T) {
+	local := bsSet[BlobStoreLocal]
+	sourcePath, destPath := "my-bucket/retry-src", "my-bucket/retry-dst"
+	if err := local.WriteRaw(sourcePath, strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer local.DeleteRaw(sourcePath)
+
+	// the local copier recognizes a wrapped local source
+	bs := WithRetry(local, RetryOptions{})
+	if err := bs.(Copier).CopyRawFrom(context.Background(), WithRetry(local, RetryOptions{}), sourcePath, destPath); err != nil {
+		t.Fatalf("copy raw from error: %v", err)
+	}
+	defer local.DeleteRaw(destPath)
+	if stats := bs.(RetryReporter).RetryStats()["CopyRawFrom"]; stats.Calls != 1 {
+		t.Fatalf("copy stats: %+v", stats)
+	}
+	if err := WithRetry(newTestMemBlobStore(t), RetryOptions{}).(Copier).CopyRawFrom(context.Background(), local, sourcePath, destPath); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("copy from local to mem: %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -1,10 +1,15 @@
 package filesystem
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -42,9 +47,22 @@ type s3BlobStore struct {
 	signedClient *s3.S3
 	bucket       string
 	subPath      string
+	urlCache     *signedURLCache
+	transfer     transferConfig
 }
 
-var _ BlobStore = &s3BlobStore{}
+var (
+	_ BlobStore        = &s3BlobStore{}
+	_ ContextBlobStore = &s3BlobStore{}
+	_ Pager            = &s3BlobStore{}
+	_ Walker           = &s3BlobStore{}
+	_ ContextPager     = &s3BlobStore{}
+	_ ContextWalker    = &s3BlobStore{}
+	_ RangeReader      = &s3BlobStore{}
+	_ OptionsWriter    = &s3BlobStore{}
+
+	_ SignedURLCacheReporter = &s3BlobStore{}
+)
 
 func newS3BlobStore(endpoint string, config map[string]string) (*s3BlobStore, error) {
 	awsConfig := &aws.Config{
@@ -75,6 +93,17 @@ func newS3BlobStore(endpoint string, config map[string]string) (*s3BlobStore, er
 	if err != nil {
 		return nil, err
 	}
+	transfer, err := parseTransferConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	urlCacheSize := defaultSignedURLCacheSize
+	if v := config[ConfigSignedURLCacheSize]; v != "" {
+		urlCacheSize, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", ConfigSignedURLCacheSize, v)
+		}
+	}
 
 	return &s3BlobStore{
 		config:       config,
@@ -83,6 +112,8 @@ func newS3BlobStore(endpoint string, config map[string]string) (*s3BlobStore, er
 		signedClient: signedClient,
 		bucket:       bucket,
 		subPath:      subPath,
+		urlCache:     newSignedURLCache(urlCacheSize),
+		transfer:     transfer,
 	}, nil
 }
 
@@ -100,7 +131,7 @@ func newSignedClient(displayHost string, awsConfig aws.Config) (*s3.S3, error) {
 func parseS3Endpoint(endpoint string) (bucket, subPath string, err error) {
 	endpoint = strings.Trim(endpoint, Delimiter)
 	if endpoint == "" {
-		return "", "", errors.New("bucket cannot be empty")
+		return "", "", fmt.Errorf("%w: bucket cannot be empty", ErrInvalidPath)
 	}
 	idx := strings.Index(endpoint, Delimiter)
 	if idx == -1 {
@@ -112,44 +143,115 @@ func parseS3Endpoint(endpoint string) (bucket, subPath string, err error) {
 func (s *s3BlobStore) getBucketAndKey(uri string) (string, string, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
-		return "", "", err
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidPath, err)
 	}
 	// 相对路径
 	if u.Scheme == "" {
 		return s.bucket, filepath.Join(s.subPath, uri), nil
 	}
 	if u.Scheme != KindS3 {
-		return "", "", errors.New("scheme should be " + KindS3)
+		return "", "", fmt.Errorf("%w: scheme should be %s", ErrInvalidPath, KindS3)
 	}
 	// 绝对路径
 	return u.Host, u.Path, nil
 }
 
+// newS3Error maps aws error codes and http status codes into the BlobStore error kinds
+func newS3Error(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var blobErr *BlobError
+	if errors.As(err, &blobErr) {
+		return err
+	}
+	kind := classifyS3Error(err)
+	if kind == nil {
+		kind = classifyError(err)
+	}
+	return &BlobError{Op: op, Path: path, Kind: kind, Cause: err}
+}
+
+func classifyS3Error(err error) error {
+	aErr, ok := err.(awserr.Error)
+	if !ok {
+		return nil
+	}
+	switch aErr.Code() {
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchUpload, "NotFound":
+		return ErrNotFound
+	case s3.ErrCodeBucketAlreadyExists, s3.ErrCodeBucketAlreadyOwnedByYou:
+		return ErrAlreadyExists
+	case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return ErrPermission
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "RequestThrottled", "TooManyRequests":
+		return ErrThrottled
+	case "KeyTooLongError", "InvalidBucketName":
+		return ErrInvalidPath
+	case "NotImplemented":
+		return ErrUnsupported
+	case "BadDigest", "InvalidDigest":
+		return ErrChecksumMismatch
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusForbidden:
+			return ErrPermission
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return ErrThrottled
+		}
+	}
+	return nil
+}
+
 func (s *s3BlobStore) fetchURLPath(path string) string {
 	return KindS3 + "://" + strings.Trim(path, Delimiter)
 }
 
 func (s *s3BlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return s.ListMetaWithContext(context.Background(), path, option)
+}
+
+func (s *s3BlobStore) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	metas, err := s.listMeta(ctx, path, option)
+	return metas, newS3Error("ListMeta", path, err)
+}
+
+func (s *s3BlobStore) listMeta(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return nil, err
 	}
 
 	input := newListObjectsV2Input(bucket, key, option)
-	output, err := s.client.ListObjectsV2(input)
+	if option.AllPages {
+		metas := make([]*BlobMeta, 0)
+		err = s.client.ListObjectsV2PagesWithContext(ctx, input, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+			metas = append(metas, s.newBlobMetas(bucket, output, option.DirectoryOnly)...)
+			return true
+		})
+		return metas, err
+	}
+	output, err := s.client.ListObjectsV2WithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
+	return s.newBlobMetas(bucket, output, option.DirectoryOnly), nil
+}
 
-	if option.DirectoryOnly {
+func (s *s3BlobStore) newBlobMetas(bucket string, output *s3.ListObjectsV2Output, directoryOnly bool) []*BlobMeta {
+	if directoryOnly {
 		metas := make([]*BlobMeta, len(output.CommonPrefixes))
 		for i, obj := range output.CommonPrefixes {
 			metas[i] = &BlobMeta{
 				Name:    strings.Trim(*obj.Prefix, Delimiter),
 				URLPath: s.fetchURLPath(filepath.Join(bucket, *obj.Prefix)),
+				IsDir:   true,
 			}
 		}
-		return metas, nil
+		return metas
 	}
 
 	metas := make([]*BlobMeta, len(output.Contents))
@@ -159,9 +261,76 @@ func (s *s3BlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta,
 			Size:         *obj.Size,
 			URLPath:      s.fetchURLPath(filepath.Join(bucket, *obj.Key)),
 			LastModified: *obj.LastModified,
+			ETag:         strings.Trim(aws.StringValue(obj.ETag), `"`),
+			StorageClass: aws.StringValue(obj.StorageClass),
+		}
+	}
+	return metas
+}
+
+func (s *s3BlobStore) Walk(path string, fn WalkFunc) error {
+	return s.WalkWithContext(context.Background(), path, fn)
+}
+
+// WalkWithContext s3 has no directories, they are made up from the key prefixes
+func (s *s3BlobStore) WalkWithContext(ctx context.Context, path string, fn WalkFunc) error {
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return newS3Error("Walk", path, err)
+	}
+	if key != "" && !strings.HasSuffix(key, Delimiter) {
+		key += Delimiter
+	}
+	w := newFlatWalker(strings.Trim(strings.TrimPrefix(key, s.subPath), Delimiter), fn)
+	var walkErr error
+	input := newListObjectsV2Input(bucket, key, ListMetaOption{})
+	err = s.client.ListObjectsV2PagesWithContext(ctx, input, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, meta := range s.newBlobMetas(bucket, output, false) {
+			if walkErr = w.visit(meta); walkErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if walkErr != nil {
+		return w.result(walkErr)
+	}
+	return newS3Error("Walk", path, err)
+}
+
+func (s *s3BlobStore) ListPage(path, cursor string, limit int64) (*MetaPage, error) {
+	return s.ListPageWithContext(context.Background(), path, cursor, limit)
+}
+
+func (s *s3BlobStore) ListPageWithContext(ctx context.Context, path, cursor string, limit int64) (*MetaPage, error) {
+	page, err := s.listPage(ctx, path, cursor, limit)
+	return page, newS3Error("ListPage", path, err)
+}
+
+// listPage the cursor wraps the s3 continuation token
+func (s *s3BlobStore) listPage(ctx context.Context, path, cursor string, limit int64) (*MetaPage, error) {
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	input := newListObjectsV2Input(bucket, key, ListMetaOption{MaxKeys: pageLimit(limit)})
+	if cursor != "" {
+		token, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
 		}
+		input.ContinuationToken = aws.String(token)
+	}
+	output, err := s.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	page := &MetaPage{Metas: s.newBlobMetas(bucket, output, false)}
+	if aws.BoolValue(output.IsTruncated) && aws.StringValue(output.NextContinuationToken) != "" {
+		page.IsTruncated = true
+		page.NextCursor = encodeCursor(*output.NextContinuationToken)
 	}
-	return metas, nil
+	return page, nil
 }
 
 func newListObjectsV2Input(bucket, key string, option ListMetaOption) *s3.ListObjectsV2Input {
@@ -185,81 +354,244 @@ func newListObjectsV2Input(bucket, key string, option ListMetaOption) *s3.ListOb
 }
 
 func (s *s3BlobStore) GetMeta(path string) (*BlobMeta, error) {
+	return s.GetMetaWithContext(context.Background(), path)
+}
+
+func (s *s3BlobStore) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	meta, err := s.getMeta(ctx, path)
+	return meta, newS3Error("GetMeta", path, err)
+}
+
+func (s *s3BlobStore) getMeta(ctx context.Context, path string) (*BlobMeta, error) {
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return nil, err
 	}
-	output, err := s.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	output, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &BlobMeta{
+	meta := &BlobMeta{
 		Name:         strings.TrimPrefix(key, s.subPath),
 		ContentType:  *output.ContentType,
 		Size:         *output.ContentLength,
 		URLPath:      s.fetchURLPath(filepath.Join(bucket, key)),
 		LastModified: *output.LastModified,
-	}, nil
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+		Checksum:     headObjectChecksum(output),
+		VersionID:    aws.StringValue(output.VersionId),
+	}
+	WriteOptions{
+		ContentEncoding: aws.StringValue(output.ContentEncoding),
+		CacheControl:    aws.StringValue(output.CacheControl),
+		Metadata:        aws.StringValueMap(output.Metadata),
+		StorageClass:    aws.StringValue(output.StorageClass),
+	}.normalize().apply(meta)
+	return meta, nil
+}
+
+// headObjectChecksum the strongest checksum s3 stored for the object
+func headObjectChecksum(output *s3.HeadObjectOutput) string {
+	switch {
+	case output.ChecksumSHA256 != nil:
+		return "sha256:" + *output.ChecksumSHA256
+	case output.ChecksumSHA1 != nil:
+		return "sha1:" + *output.ChecksumSHA1
+	case output.ChecksumCRC32C != nil:
+		return "crc32c:" + *output.ChecksumCRC32C
+	case output.ChecksumCRC32 != nil:
+		return "crc32:" + *output.ChecksumCRC32
+	}
+	return ""
 }
 
 func (s *s3BlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	return s.ReadRawWithContext(context.Background(), path)
+}
+
+func (s *s3BlobStore) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := s.readRaw(ctx, path)
+	return rc, newS3Error("ReadRaw", path, err)
+}
+
+func (s *s3BlobStore) readRaw(ctx context.Context, path string) (io.ReadCloser, error) {
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// ReadRange uses a http Range request
+func (s *s3BlobStore) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := s.readRange(path, offset, length)
+	return rc, newS3Error("ReadRange", path, err)
+}
+
+func (s *s3BlobStore) readRange(path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, errNegativeOffset
+	}
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return nil, err
 	}
-	response, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	response, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Range: aws.String(byteRange)})
 	if err != nil {
+		// offset is beyond the end of the object
+		if aErr, ok := err.(awserr.Error); ok && aErr.Code() == "InvalidRange" {
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		}
 		return nil, err
 	}
 	return response.Body, nil
 }
 
 func (s *s3BlobStore) WriteRaw(path string, in io.Reader) error {
+	return s.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (s *s3BlobStore) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	return newS3Error("WriteRaw", path, s.writeRaw(ctx, path, in, WriteOptions{}))
+}
+
+func (s *s3BlobStore) WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error {
+	return newS3Error("WriteRawWithOptions", path, s.writeRaw(context.Background(), path, in, opts))
+}
+
+func (s *s3BlobStore) writeRaw(ctx context.Context, path string, in io.Reader, opts WriteOptions) error {
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return err
 	}
-	// create bucket if not exist
-	_, err = s.client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	if err = s.ensureBucket(ctx, bucket); err != nil {
+		return err
+	}
+	defer s.urlCache.invalidate(bucket, key)
+	if rs, start, size, ok := s.resumable(in, opts); ok {
+		return s.resumableUpload(ctx, bucket, key, rs, start, size, opts)
+	}
+	_, err = s.newUploader().UploadWithContext(ctx, newUploadInput(bucket, key, in, opts))
+	return err
+}
+
+// ensureBucket create bucket if not exist
+func (s *s3BlobStore) ensureBucket(ctx context.Context, bucket string) error {
+	_, err := s.client.CreateBucketWithContext(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
 	if err != nil {
 		aErr, ok := err.(awserr.Error)
 		if !ok || !(aErr.Code() == s3.ErrCodeBucketAlreadyExists || aErr.Code() == s3.ErrCodeBucketAlreadyOwnedByYou) {
 			return err
 		}
 	}
-	uploader := s3manager.NewUploaderWithClient(s.client)
-	_, err = uploader.Upload(&s3manager.UploadInput{
+	return nil
+}
+
+func newUploadInput(bucket, key string, in io.Reader, opts WriteOptions) *s3manager.UploadInput {
+	input := &s3manager.UploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 		Body:   in,
-	})
-	return err
+	}
+	opts = opts.normalize()
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	if algorithm, value, err := parseChecksum(opts.Checksum); err == nil {
+		switch algorithm {
+		case ChecksumMD5:
+			input.ContentMD5 = aws.String(value)
+		case ChecksumCRC32C:
+			input.ChecksumCRC32C = aws.String(value)
+		case ChecksumSHA256:
+			input.ChecksumSHA256 = aws.String(value)
+		}
+	}
+	return input
 }
 
 func (s *s3BlobStore) DeleteRaw(path string) error {
+	return s.DeleteRawWithContext(context.Background(), path)
+}
+
+func (s *s3BlobStore) DeleteRawWithContext(ctx context.Context, path string) error {
+	return newS3Error("DeleteRaw", path, s.deleteRaw(ctx, path))
+}
+
+func (s *s3BlobStore) deleteRaw(ctx context.Context, path string) error {
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return err
 	}
-	_, err = s.client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	defer s.urlCache.invalidate(bucket, key)
+	_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
 	return err
 }
 
 func (s *s3BlobStore) GetSignedURL(path string, expire time.Duration) (string, error) {
+	return s.GetSignedURLWithContext(context.Background(), path, expire)
+}
+
+func (s *s3BlobStore) GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error) {
+	signed, err := s.getSignedURL(ctx, path, expire)
+	return signed, newS3Error("GetSignedURL", path, err)
+}
+
+func (s *s3BlobStore) getSignedURL(ctx context.Context, path string, expire time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	bucket, key, err := s.getBucketAndKey(path)
 	if err != nil {
 		return "", err
 	}
-	// todo: cache
+	if expire == 0 {
+		expire = defaultExpire
+	}
+	if signed, ok := s.urlCache.get(bucket, key, expire); ok {
+		return signed, nil
+	}
 
 	req, _ := s.signedClient.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	req.SetContext(ctx)
+	signed, err := req.Presign(expire)
 	if err != nil {
 		return "", err
 	}
-	if expire == 0 {
-		expire = defaultExpire
-	}
-	return req.Presign(expire)
+	s.urlCache.put(bucket, key, expire, signed)
+	return signed, nil
+}
+
+// SignedURLCacheStats counters of the GetSignedURL cache, see ConfigSignedURLCacheSize
+func (s *s3BlobStore) SignedURLCacheStats() SignedURLCacheStats {
+	return s.urlCache.statsSnapshot()
 }
 
 func (s *s3BlobStore) BuildURL(path string) (string, error) {
@@ -0,0 +1,142 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// MaxCopyObjectSize larger objects need a multipart copy
+	MaxCopyObjectSize = 5 << 30
+	minCopyPartSize   = 512 << 20
+	maxCopyParts      = 10000
+)
+
+var (
+	_ Copier            = &s3BlobStore{}
+	_ copySourceChecker = &s3BlobStore{}
+)
+
+// CopyRawFrom copies server side with CopyObject, or UploadPartCopy for objects over MaxCopyObjectSize.
+// source must be a s3 store on the same host with the same credentials.
+func (s *s3BlobStore) CopyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	return newS3Error("CopyRawFrom", destPath, s.copyRawFrom(ctx, source, sourcePath, destPath))
+}
+
+func (s *s3BlobStore) canCopyFrom(source BlobStore) bool {
+	src, ok := unwrapBlobStore(source).(*s3BlobStore)
+	return ok && s.sameEndpoint(src)
+}
+
+func (s *s3BlobStore) copyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	if !s.canCopyFrom(source) {
+		return fmt.Errorf("%w: server side copy from %T", ErrUnsupported, source)
+	}
+	src := unwrapBlobStore(source).(*s3BlobStore)
+	srcBucket, srcKey, err := src.getBucketAndKey(sourcePath)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := s.getBucketAndKey(destPath)
+	if err != nil {
+		return err
+	}
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(srcBucket), Key: aws.String(srcKey)})
+	if err != nil {
+		return err
+	}
+	if err = s.ensureBucket(ctx, bucket); err != nil {
+		return err
+	}
+	defer s.urlCache.invalidate(bucket, key)
+	copySource := copySourceOf(srcBucket, srcKey)
+	if aws.Int64Value(head.ContentLength) <= MaxCopyObjectSize {
+		_, err = s.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			CopySource: aws.String(copySource),
+		})
+		return err
+	}
+	return s.multipartCopy(ctx, head, copySource, bucket, key)
+}
+
+// sameEndpoint a server side copy needs both stores to talk to the same service as the same user
+func (s *s3BlobStore) sameEndpoint(other *s3BlobStore) bool {
+	return s.config[ConfigHost] == other.config[ConfigHost] && s.config[ConfigAk] == other.config[ConfigAk]
+}
+
+func copySourceOf(bucket, key string) string {
+	segments := strings.Split(bucket+"/"+key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *s3BlobStore) multipartCopy(ctx context.Context, head *s3.HeadObjectOutput, copySource, bucket, key string) (err error) {
+	created, err := s.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		ContentType:     head.ContentType,
+		ContentEncoding: head.ContentEncoding,
+		CacheControl:    head.CacheControl,
+		Metadata:        head.Metadata,
+		StorageClass:    head.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      aws.String(key),
+				UploadId: created.UploadId,
+			})
+		}
+	}()
+
+	size := aws.Int64Value(head.ContentLength)
+	partSize := copyPartSize(size)
+	parts := make([]*s3.CompletedPart, 0, size/partSize+1)
+	for offset, number := int64(0), int64(1); offset < size; offset, number = offset+partSize, number+1 {
+		end := offset + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		output, err := s.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        created.UploadId,
+			PartNumber:      aws.Int64(number),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: aws.Int64(number)})
+	}
+	_, err = s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+// copyPartSize keeps the number of parts within the s3 limit
+func copyPartSize(size int64) int64 {
+	partSize := int64(minCopyPartSize)
+	if min := (size + maxCopyParts - 1) / maxCopyParts; min > partSize {
+		partSize = min
+	}
+	return partSize
+}
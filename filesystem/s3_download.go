@@ -0,0 +1,125 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var _ ParallelDownloader = &s3BlobStore{}
+
+// DownloadAt downloads with the s3manager downloader, partSize and concurrency as configured
+func (s *s3BlobStore) DownloadAt(ctx context.Context, path string, w io.WriterAt) (int64, error) {
+	n, err := s.downloadAt(ctx, path, w)
+	return n, newS3Error("DownloadAt", path, err)
+}
+
+func (s *s3BlobStore) downloadAt(ctx context.Context, path string, w io.WriterAt) (int64, error) {
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+	downloader := s3manager.NewDownloaderWithClient(s.client, func(d *s3manager.Downloader) {
+		d.PartSize = s.transfer.partSize
+		d.Concurrency = s.transfer.concurrency
+	})
+	return downloader.DownloadWithContext(ctx, w, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+}
+
+// ParallelDownloadThreshold see ConfigParallelDownloadThreshold
+func (s *s3BlobStore) ParallelDownloadThreshold() int64 {
+	return s.transfer.downloadThreshold
+}
+
+// DownloadStream fetches the parts concurrently, at most concurrency parts are buffered
+func (s *s3BlobStore) DownloadStream(ctx context.Context, path string) (io.ReadCloser, error) {
+	stream, err := s.downloadStream(ctx, path)
+	return stream, newS3Error("DownloadStream", path, err)
+}
+
+type downloadedPart struct {
+	data []byte
+	err  error
+}
+
+func (s *s3BlobStore) downloadStream(ctx context.Context, path string) (io.ReadCloser, error) {
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	head, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	size, partSize := aws.Int64Value(head.ContentLength), s.transfer.partSize
+	if partSize <= 0 {
+		partSize = s3manager.DefaultDownloadPartSize
+	}
+	concurrency := s.transfer.concurrency
+	if concurrency <= 0 {
+		concurrency = s3manager.DefaultDownloadConcurrency
+	}
+	if size <= partSize {
+		return s.readRaw(ctx, path)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	// parts in download order, the capacity bounds the buffered parts
+	pending := make(chan chan downloadedPart, concurrency)
+	go func() {
+		defer close(pending)
+		for offset := int64(0); offset < size; offset += partSize {
+			result := make(chan downloadedPart, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(offset int64) {
+				data, err := s.downloadPart(ctx, bucket, key, head.ETag, offset, partSize)
+				result <- downloadedPart{data: data, err: err}
+			}(offset)
+		}
+	}()
+	go func() {
+		defer cancel()
+		for result := range pending {
+			part := <-result
+			if part.err != nil {
+				pw.CloseWithError(part.err)
+				return
+			}
+			if _, err := pw.Write(part.data); err != nil {
+				return
+			}
+		}
+		pw.CloseWithError(ctx.Err())
+	}()
+	return &readCloser{Reader: pr, Closer: closerFunc(func() error {
+		cancel()
+		return pr.Close()
+	})}, nil
+}
+
+// downloadPart pins the ETag, an object overwritten during the download fails it instead of mixing versions
+func (s *s3BlobStore) downloadPart(ctx context.Context, bucket, key string, etag *string, offset, length int64) ([]byte, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+		IfMatch: etag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	buf := bytes.NewBuffer(make([]byte, 0, aws.Int64Value(out.ContentLength)))
+	_, err = io.Copy(buf, out.Body)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,145 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDownloadStore(t *testing.T) (*s3BlobStore, *fakeS3, []byte) {
+	s, fake := newFakeS3Store(t, map[string]string{ConfigConcurrency: "3"})
+	s.transfer.partSize = 1024
+	data := make([]byte, 10*1024+10)
+	rand.New(rand.NewSource(1)).Read(data)
+	fake.putObject("big", data)
+	return s, fake, data
+}
+
+func TestDownloadAt(t *testing.T) {
+	s, fake, data := newTestDownloadStore(t)
+	file, err := os.Create(filepath.Join(t.TempDir(), "big"))
+	if err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	defer file.Close()
+	n, err := DownloadAt(context.Background(), s, "big", file)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("download at: %d %v", n, err)
+	}
+	content, err := os.ReadFile(file.Name())
+	if err != nil || !bytes.Equal(content, data) {
+		t.Fatalf("downloaded content differs: %v", err)
+	}
+	if got := fake.requestCount("GETObject"); got != 11 {
+		t.Fatalf("ranged gets: %d, want 11", got)
+	}
+
+	// other stores are streamed
+	mem := newTestMemBlobStore(t, "small")
+	var buf bytes.Buffer
+	n, err = DownloadAt(context.Background(), mem, "small", &bufferWriterAt{buf: &buf})
+	if err != nil || n != 5 || buf.String() != "small" {
+		t.Fatalf("mem download at: %d %v %q", n, err, buf.String())
+	}
+}
+
+// bufferWriterAt accepts sequential writes only
+type bufferWriterAt struct {
+	buf *bytes.Buffer
+}
+
+func (b *bufferWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off != int64(b.buf.Len()) {
+		return 0, errors.New("not sequential")
+	}
+	return b.buf.Write(p)
+}
+
+func TestDownloadStream(t *testing.T) {
+	s, fake, data := newTestDownloadStore(t)
+	stream, err := DownloadStream(context.Background(), s, "big")
+	if err != nil {
+		t.Fatalf("download stream error: %v", err)
+	}
+	content, err := ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil || !bytes.Equal(content, data) {
+		t.Fatalf("streamed content differs: %v", err)
+	}
+	if got := fake.requestCount("GETObject"); got != 11 {
+		t.Fatalf("ranged gets: %d, want 11", got)
+	}
+
+	// closing early stops the download
+	stream, err = s.DownloadStream(context.Background(), "big")
+	if err != nil {
+		t.Fatalf("download stream error: %v", err)
+	}
+	if _, err = io.ReadFull(stream, make([]byte, 100)); err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	// an overwrite during the download fails it instead of mixing versions
+	stream, err = s.DownloadStream(context.Background(), "big")
+	if err != nil {
+		t.Fatalf("download stream error: %v", err)
+	}
+	defer stream.Close()
+	if _, err = io.ReadFull(stream, make([]byte, 1024)); err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	fake.putObject("big", bytes.Repeat([]byte("x"), len(data)))
+	if _, err = ioutil.ReadAll(stream); err == nil {
+		t.Fatalf("download of an overwritten object succeeded")
+	}
+}
+
+func TestCopyRawParallelDownload(t *testing.T) {
+	s, fake, data := newTestDownloadStore(t)
+	local, err := NewBlobStore(KindLocal, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("new local blob store error: %v", err)
+	}
+
+	if got := WithRetry(s, RetryOptions{}).(ParallelDownloader).ParallelDownloadThreshold(); got != defaultParallelDownloadThreshold {
+		t.Fatalf("threshold through a wrapper: %d, want %d", got, defaultParallelDownloadThreshold)
+	}
+
+	// below the threshold the object is streamed
+	s.transfer.downloadThreshold = int64(len(data)) + 1
+	if err = CopyRaw(s, local, "big", "streamed"); err != nil {
+		t.Fatalf("copy raw error: %v", err)
+	}
+	if got := fake.requestCount("GETObject"); got != 1 {
+		t.Fatalf("gets below the threshold: %d, want 1", got)
+	}
+
+	// a decorated source is downloaded in parallel too
+	s.transfer.downloadThreshold = int64(len(data))
+	if err = CopyRaw(WithMetrics(s, "s3", NewMetricsRegistry()), local, "big", "dir/downloaded"); err != nil {
+		t.Fatalf("copy raw error: %v", err)
+	}
+	if got := fake.requestCount("GETObject"); got != 12 {
+		t.Fatalf("gets above the threshold: %d, want 12", got)
+	}
+	for _, path := range []string{"streamed", "dir/downloaded"} {
+		out, err := local.ReadRaw(path)
+		if err != nil {
+			t.Fatalf("read raw error: %v", err)
+		}
+		content, err := ioutil.ReadAll(out)
+		out.Close()
+		if err != nil || !bytes.Equal(content, data) {
+			t.Fatalf("copied content of %s differs: %v", path, err)
+		}
+	}
+}
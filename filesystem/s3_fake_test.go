@@ -0,0 +1,209 @@
+package filesystem
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 an in-process s3 speaking just enough of the API for the multipart and ranged read tests
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]*fakeUpload
+	nextID  int
+	// failPart makes UploadPart of this part number fail once
+	failPart int
+	// requests counts the requests by operation
+	requests map[string]int
+}
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+// newFakeS3Store returns a store of bucket my-bucket backed by a fakeS3
+func newFakeS3Store(t *testing.T, config map[string]string) (*s3BlobStore, *fakeS3) {
+	fake := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]*fakeUpload), requests: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("ak", "sk", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatalf("new session error: %v", err)
+	}
+	transfer, err := parseTransferConfig(config)
+	if err != nil {
+		t.Fatalf("parse transfer config error: %v", err)
+	}
+	client := s3.New(sess)
+	return &s3BlobStore{
+		config:       config,
+		client:       client,
+		signedClient: client,
+		bucket:       "my-bucket",
+		subPath:      "/",
+		transfer:     transfer,
+	}, fake
+}
+
+func (f *fakeS3) putObject(key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = data
+}
+
+func (f *fakeS3) requestCount(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[op]
+}
+
+func (f *fakeS3) object(key string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[key]
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) writeXML(w http.ResponseWriter, v interface{}) {
+	data, _ := xml.Marshal(v)
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query()
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := parts[0], ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	_, uploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case key == "" && r.Method == http.MethodPut:
+		f.requests["CreateBucket"]++
+	case key == "" && r.Method == http.MethodGet && uploads:
+		f.requests["ListMultipartUploads"]++
+		type upload struct {
+			Key       string
+			UploadId  string
+			Initiated time.Time
+		}
+		result := struct {
+			XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+			Bucket  string
+			Uploads []upload `xml:"Upload"`
+		}{Bucket: bucket}
+		for id, u := range f.uploads {
+			if strings.HasPrefix(u.key, query.Get("prefix")) {
+				result.Uploads = append(result.Uploads, upload{Key: u.key, UploadId: id, Initiated: u.initiated})
+			}
+		}
+		f.writeXML(w, result)
+	case r.Method == http.MethodPost && uploads:
+		f.requests["CreateMultipartUpload"]++
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = &fakeUpload{key: key, initiated: time.Now(), parts: make(map[int][]byte)}
+		f.writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case uploadID != "":
+		upload, ok := f.uploads[uploadID]
+		if !ok {
+			f.writeError(w, http.StatusNotFound, s3.ErrCodeNoSuchUpload)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			f.requests["UploadPart"]++
+			number, _ := strconv.Atoi(query.Get("partNumber"))
+			if number == f.failPart {
+				f.failPart = 0
+				f.writeError(w, http.StatusInternalServerError, "InternalError")
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			upload.parts[number] = data
+			sum := md5.Sum(data)
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		case http.MethodGet:
+			f.requests["ListParts"]++
+			f.writeXML(w, struct {
+				XMLName  xml.Name `xml:"ListPartsResult"`
+				UploadId string
+			}{UploadId: uploadID})
+		case http.MethodPost:
+			f.requests["CompleteMultipartUpload"]++
+			numbers := make([]int, 0, len(upload.parts))
+			for number := range upload.parts {
+				numbers = append(numbers, number)
+			}
+			sort.Ints(numbers)
+			var data []byte
+			for _, number := range numbers {
+				data = append(data, upload.parts[number]...)
+			}
+			f.objects[key] = data
+			delete(f.uploads, uploadID)
+			f.writeXML(w, struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				Key     string
+			}{Key: key})
+		case http.MethodDelete:
+			f.requests["AbortMultipartUpload"]++
+			delete(f.uploads, uploadID)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodPut:
+		f.requests["PutObject"]++
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.requests[r.Method+"Object"]++
+		data, ok := f.objects[key]
+		if !ok {
+			f.writeError(w, http.StatusNotFound, s3.ErrCodeNoSuchKey)
+			return
+		}
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		http.ServeContent(w, r, key, time.Time{}, strings.NewReader(string(data)))
+	default:
+		f.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
@@ -0,0 +1,456 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// ConfigPartSize bytes per part of multipart uploads and parallel downloads, at least 5MiB
+	ConfigPartSize = "partSize"
+	// ConfigConcurrency parts transferred concurrently
+	ConfigConcurrency = "concurrency"
+	// ConfigMaxBufferMemory bytes of part buffers a transfer may hold, lowers the concurrency if needed
+	ConfigMaxBufferMemory = "maxBufferMemory"
+	// ConfigJournalDir makes uploads of seekable streams resumable: the upload id and the finished
+	// parts are journaled there, a restarted process writing the same path continues the upload
+	ConfigJournalDir = "journalDir"
+	// ConfigParallelDownloadThreshold bytes from which objects copied to local stores are
+	// downloaded with concurrent ranged reads
+	ConfigParallelDownloadThreshold = "parallelDownloadThreshold"
+)
+
+const defaultParallelDownloadThreshold = 64 << 20
+
+// transferConfig tuning of multipart uploads and parallel downloads
+type transferConfig struct {
+	partSize          int64
+	concurrency       int
+	journalDir        string
+	downloadThreshold int64
+	// maxBufferMemory 0 is unlimited
+	maxBufferMemory int64
+}
+
+func parseTransferConfig(config map[string]string) (transferConfig, error) {
+	cfg := transferConfig{
+		partSize:          s3manager.DefaultUploadPartSize,
+		concurrency:       s3manager.DefaultUploadConcurrency,
+		journalDir:        config[ConfigJournalDir],
+		downloadThreshold: defaultParallelDownloadThreshold,
+	}
+	if v := config[ConfigPartSize]; v != "" {
+		partSize, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || partSize < s3manager.MinUploadPartSize {
+			return cfg, fmt.Errorf("invalid %s: %s, want at least %d", ConfigPartSize, v, s3manager.MinUploadPartSize)
+		}
+		cfg.partSize = partSize
+	}
+	if v := config[ConfigConcurrency]; v != "" {
+		concurrency, err := strconv.Atoi(v)
+		if err != nil || concurrency < 1 {
+			return cfg, fmt.Errorf("invalid %s: %s", ConfigConcurrency, v)
+		}
+		cfg.concurrency = concurrency
+	}
+	if v := config[ConfigMaxBufferMemory]; v != "" {
+		maxMemory, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxMemory < cfg.partSize {
+			return cfg, fmt.Errorf("invalid %s: %s, want at least %s %d", ConfigMaxBufferMemory, v, ConfigPartSize, cfg.partSize)
+		}
+		cfg.maxBufferMemory = maxMemory
+		cfg.concurrency = cfg.concurrencyFor(cfg.partSize)
+	}
+	if v := config[ConfigParallelDownloadThreshold]; v != "" {
+		threshold, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || threshold < 0 {
+			return cfg, fmt.Errorf("invalid %s: %s", ConfigParallelDownloadThreshold, v)
+		}
+		cfg.downloadThreshold = threshold
+	}
+	if cfg.journalDir != "" {
+		if err := os.MkdirAll(cfg.journalDir, 0777); err != nil {
+			return cfg, fmt.Errorf("invalid %s: %v", ConfigJournalDir, err)
+		}
+	}
+	return cfg, nil
+}
+
+// partSizeFor grows the part size for objects which would need more than MaxUploadParts parts
+func (c transferConfig) partSizeFor(size int64) int64 {
+	if min := (size + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts; min > c.partSize {
+		return min
+	}
+	return c.partSize
+}
+
+// concurrencyFor lowers the concurrency so the buffers of parts of partSize fit in maxBufferMemory
+func (c transferConfig) concurrencyFor(partSize int64) int {
+	if c.maxBufferMemory > 0 && int64(c.concurrency)*partSize > c.maxBufferMemory {
+		return int(c.maxBufferMemory / partSize)
+	}
+	return c.concurrency
+}
+
+func (s *s3BlobStore) newUploader() *s3manager.Uploader {
+	return s3manager.NewUploaderWithClient(s.client, func(u *s3manager.Uploader) {
+		u.PartSize = s.transfer.partSize
+		u.Concurrency = s.transfer.concurrency
+	})
+}
+
+// resumable reports whether in is written by resumableUpload, it returns the offset of in
+// and the size left from there, the bytes before the offset are not written
+func (s *s3BlobStore) resumable(in io.Reader, opts WriteOptions) (rs io.ReadSeeker, start, size int64, ok bool) {
+	rs, ok = in.(io.ReadSeeker)
+	// a checksum of the whole object is only verified by the uploader
+	if !ok || s.transfer.journalDir == "" || opts.Checksum != "" {
+		return nil, 0, 0, false
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+	if _, err = rs.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, 0, false
+	}
+	return rs, start, end - start, end-start > s.transfer.partSize
+}
+
+// uploadJournal the state of a resumable upload, rewritten after every part
+type uploadJournal struct {
+	Bucket   string                 `json:"bucket"`
+	Key      string                 `json:"key"`
+	UploadID string                 `json:"uploadId"`
+	Size     int64                  `json:"size"`
+	PartSize int64                  `json:"partSize"`
+	Parts    map[int64]uploadedPart `json:"parts"`
+}
+
+type uploadedPart struct {
+	ETag string `json:"etag"`
+	// MD5 base64 of the part content, a resumed part is only skipped if the content still matches
+	MD5 string `json:"md5"`
+}
+
+// journalPath the journal of bucket/key on the s3 server at endpoint
+func journalPath(dir, endpoint, bucket, key string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\n" + bucket + "/" + key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// loadJournal returns nil if there is no journal
+func loadJournal(path string) (*uploadJournal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	journal := &uploadJournal{}
+	if err = json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("invalid upload journal %s: %v", path, err)
+	}
+	return journal, nil
+}
+
+func (j *uploadJournal) save(path string) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	file, err := createAtomicFile(path, 0666, false)
+	if err != nil {
+		return err
+	}
+	defer file.abort()
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	return file.commit()
+}
+
+// resumeJournal loads the journal of bucket/key if its upload can be continued
+func (s *s3BlobStore) resumeJournal(ctx context.Context, path, bucket, key string, size, partSize int64) (*uploadJournal, error) {
+	journal, err := loadJournal(path)
+	if err != nil || journal == nil {
+		return nil, err
+	}
+	if journal.Bucket != bucket || journal.Key != key || journal.Size != size || journal.PartSize != partSize {
+		// another content is written now, the old upload is abandoned
+		s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket: aws.String(journal.Bucket), Key: aws.String(journal.Key), UploadId: aws.String(journal.UploadID),
+		})
+		return nil, nil
+	}
+	_, err = s.client.ListPartsWithContext(ctx, &s3.ListPartsInput{
+		Bucket: aws.String(bucket), Key: aws.String(key), UploadId: aws.String(journal.UploadID), MaxParts: aws.Int64(1),
+	})
+	if aErr, ok := err.(awserr.Error); ok && aErr.Code() == s3.ErrCodeNoSuchUpload {
+		// completed or aborted meanwhile
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// resumableUpload uploads the parts of the size bytes of in from start missing from the journal,
+// the journal is kept on failure
+func (s *s3BlobStore) resumableUpload(ctx context.Context, bucket, key string, in io.ReadSeeker, start, size int64, opts WriteOptions) error {
+	path := journalPath(s.transfer.journalDir, s.client.Endpoint, bucket, key)
+	partSize := s.transfer.partSizeFor(size)
+	concurrency := s.transfer.concurrencyFor(partSize)
+	if concurrency < 1 {
+		return fmt.Errorf("%w: parts of %d bytes exceed %s %d", ErrUnsupported, partSize, ConfigMaxBufferMemory, s.transfer.maxBufferMemory)
+	}
+	journal, err := s.resumeJournal(ctx, path, bucket, key, size, partSize)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		out, err := s.client.CreateMultipartUploadWithContext(ctx, newCreateMultipartUploadInput(bucket, key, opts))
+		if err != nil {
+			return err
+		}
+		journal = &uploadJournal{
+			Bucket:   bucket,
+			Key:      key,
+			UploadID: aws.StringValue(out.UploadId),
+			Size:     size,
+			PartSize: partSize,
+			Parts:    make(map[int64]uploadedPart),
+		}
+		if err = journal.save(path); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	parts := (size + partSize - 1) / partSize
+	jobs := make(chan int64)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, partSize)
+			for number := range jobs {
+				if err := s.uploadPart(ctx, journal, path, &mu, in, start, number, buf); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	for number := int64(1); number <= parts && ctx.Err() == nil; number++ {
+		jobs <- number
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(journal.Parts))
+	for number, part := range journal.Parts {
+		completed = append(completed, &s3.CompletedPart{PartNumber: aws.Int64(number), ETag: aws.String(part.ETag)})
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return *completed[i].PartNumber < *completed[j].PartNumber
+	})
+	_, err = s.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(journal.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// uploadPart reads the part of in from start into buf and uploads it unless the journal has it already,
+// mu guards in and the journal
+func (s *s3BlobStore) uploadPart(ctx context.Context, journal *uploadJournal, path string, mu *sync.Mutex, in io.ReadSeeker, start, number int64, buf []byte) error {
+	offset := (number - 1) * journal.PartSize
+	length := journal.Size - offset
+	if length > journal.PartSize {
+		length = journal.PartSize
+	}
+	mu.Lock()
+	_, err := in.Seek(start+offset, io.SeekStart)
+	if err == nil {
+		_, err = io.ReadFull(in, buf[:length])
+	}
+	done, ok := journal.Parts[number]
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(buf[:length])
+	contentMD5 := base64.StdEncoding.EncodeToString(sum[:])
+	if ok && done.MD5 == contentMD5 {
+		return nil
+	}
+
+	out, err := s.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(journal.Bucket),
+		Key:           aws.String(journal.Key),
+		UploadId:      aws.String(journal.UploadID),
+		PartNumber:    aws.Int64(number),
+		Body:          bytes.NewReader(buf[:length]),
+		ContentLength: aws.Int64(length),
+		ContentMD5:    aws.String(contentMD5),
+	})
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	journal.Parts[number] = uploadedPart{ETag: aws.StringValue(out.ETag), MD5: contentMD5}
+	return journal.save(path)
+}
+
+func newCreateMultipartUploadInput(bucket, key string, opts WriteOptions) *s3.CreateMultipartUploadInput {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	opts = opts.normalize()
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	return input
+}
+
+// UploadCleaner is implemented by stores whose interrupted uploads keep using storage
+type UploadCleaner interface {
+	// AbortStaleUploads aborts the unfinished uploads below prefix started more than olderThan ago
+	// and returns how many were aborted
+	AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error)
+}
+
+var _ UploadCleaner = &s3BlobStore{}
+
+// AbortStaleUploads also removes the journals of the aborted uploads
+func (s *s3BlobStore) AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	aborted, err := s.abortStaleUploads(ctx, prefix, olderThan)
+	return aborted, newS3Error("AbortStaleUploads", prefix, err)
+}
+
+func (s *s3BlobStore) abortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	bucket, key, err := s.getBucketAndKey(prefix)
+	if err != nil {
+		return 0, err
+	}
+	keyPrefix := strings.TrimPrefix(key, Delimiter)
+	if strings.HasSuffix(prefix, Delimiter) && keyPrefix != "" {
+		keyPrefix += Delimiter
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var stale []*s3.MultipartUpload
+	err = s.client.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(keyPrefix),
+	}, func(output *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range output.Uploads {
+			if aws.TimeValue(upload.Initiated).Before(cutoff) {
+				stale = append(stale, upload)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	abortedIDs := make(map[string]bool, len(stale))
+	for _, upload := range stale {
+		_, err = s.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if aErr, ok := err.(awserr.Error); err != nil && !(ok && aErr.Code() == s3.ErrCodeNoSuchUpload) {
+			return len(abortedIDs), err
+		}
+		abortedIDs[aws.StringValue(upload.UploadId)] = true
+	}
+	return len(abortedIDs), s.removeJournals(abortedIDs)
+}
+
+// removeJournals removes the journals of the given upload ids
+func (s *s3BlobStore) removeJournals(uploadIDs map[string]bool) error {
+	if s.transfer.journalDir == "" || len(uploadIDs) == 0 {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(s.transfer.journalDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		journal, err := loadJournal(path)
+		if err != nil || journal == nil || !uploadIDs[journal.UploadID] {
+			continue
+		}
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
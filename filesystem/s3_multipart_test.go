@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTransferConfig(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		config          map[string]string
+		wantPartSize    int64
+		wantConcurrency int
+		wantErr         bool
+	}{
+		{desc: "defaults", config: map[string]string{}, wantPartSize: 5 << 20, wantConcurrency: 5},
+		{desc: "tuned", config: map[string]string{ConfigPartSize: "16777216", ConfigConcurrency: "8"}, wantPartSize: 16 << 20, wantConcurrency: 8},
+		{desc: "memory caps concurrency", config: map[string]string{ConfigPartSize: "8388608", ConfigMaxBufferMemory: "20000000"}, wantPartSize: 8 << 20, wantConcurrency: 2},
+		{desc: "part size too small", config: map[string]string{ConfigPartSize: "1024"}, wantErr: true},
+		{desc: "zero concurrency", config: map[string]string{ConfigConcurrency: "0"}, wantErr: true},
+		{desc: "memory below one part", config: map[string]string{ConfigMaxBufferMemory: "1024"}, wantErr: true},
+		{desc: "negative download threshold", config: map[string]string{ConfigParallelDownloadThreshold: "-1"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg, err := parseTransferConfig(tc.config)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("invalid config accepted: %+v", cfg)
+				}
+				return
+			}
+			if err != nil || cfg.partSize != tc.wantPartSize || cfg.concurrency != tc.wantConcurrency {
+				t.Fatalf("config: %+v %v, want part size %d concurrency %d", cfg, err, tc.wantPartSize, tc.wantConcurrency)
+			}
+		})
+	}
+
+	cfg := transferConfig{partSize: 5 << 20}
+	if got := cfg.partSizeFor(100 << 30); got != (100<<30+9999)/10000 {
+		t.Fatalf("part size for 100GiB: %d", got)
+	}
+
+	// grown parts lower the concurrency to stay within the buffer memory
+	cfg = transferConfig{partSize: 5 << 20, concurrency: 4, maxBufferMemory: 20 << 20}
+	for partSize, want := range map[int64]int{5 << 20: 4, 8 << 20: 2, 30 << 20: 0} {
+		if got := cfg.concurrencyFor(partSize); got != want {
+			t.Fatalf("concurrency for parts of %d: %d, want %d", partSize, got, want)
+		}
+	}
+}
+
+func newTestResumableStore(t *testing.T) (*s3BlobStore, *fakeS3, string) {
+	journalDir := t.TempDir()
+	s, fake := newFakeS3Store(t, map[string]string{ConfigJournalDir: journalDir, ConfigConcurrency: "2"})
+	// below the s3 minimum to keep the test small, the fake does not check it
+	s.transfer.partSize = 1024
+	return s, fake, journalDir
+}
+
+func TestResumableUpload(t *testing.T) {
+	s, fake, journalDir := newTestResumableStore(t)
+	// one part at a time, no request is in flight when the upload fails
+	s.transfer.concurrency = 1
+	data := make([]byte, 5*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	fake.failPart = 4
+	if err := s.WriteRaw("big", bytes.NewReader(data)); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	journals, _ := filepath.Glob(filepath.Join(journalDir, "*.json"))
+	if len(journals) != 1 {
+		t.Fatalf("journals after the interruption: %v", journals)
+	}
+	journal, err := loadJournal(journals[0])
+	if err != nil || len(journal.Parts) != 3 {
+		t.Fatalf("journal: %+v %v", journal, err)
+	}
+	uploaded := fake.requests["UploadPart"]
+
+	// a restarted process writes the same content again
+	if err = s.WriteRaw("big", bytes.NewReader(data)); err != nil {
+		t.Fatalf("resumed upload error: %v", err)
+	}
+	if !bytes.Equal(fake.object("big"), data) {
+		t.Fatalf("uploaded object differs")
+	}
+	if fake.requests["CreateMultipartUpload"] != 1 {
+		t.Fatalf("upload restarted: %v", fake.requests)
+	}
+	if resent := fake.requests["UploadPart"] - uploaded; resent != 6-len(journal.Parts) {
+		t.Fatalf("resumed upload sent %d parts, want %d", resent, 6-len(journal.Parts))
+	}
+	if _, err = os.Stat(journals[0]); !os.IsNotExist(err) {
+		t.Fatalf("journal not removed: %v", err)
+	}
+
+	// changed content of the same size does not reuse the parts
+	fake.failPart = 6
+	if err = s.WriteRaw("big", bytes.NewReader(data)); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	changed := append([]byte{}, data...)
+	changed[0]++
+	if err = s.WriteRaw("big", bytes.NewReader(changed)); err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	if !bytes.Equal(fake.object("big"), changed) {
+		t.Fatalf("uploaded object has stale parts")
+	}
+
+	// small objects are put in one request by the uploader, which checks the part size
+	s.transfer.partSize = 5 << 20
+	if err = s.WriteRaw("small", bytes.NewReader(data[:100])); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if fake.requests["PutObject"] != 1 {
+		t.Fatalf("requests: %v", fake.requests)
+	}
+}
+
+func TestResumableUploadFromOffset(t *testing.T) {
+	s, fake, _ := newTestResumableStore(t)
+	data := make([]byte, 3*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	in := bytes.NewReader(data)
+	in.Seek(500, io.SeekStart)
+	if err := s.WriteRaw("big", in); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	if fake.requests["CreateMultipartUpload"] != 1 {
+		t.Fatalf("requests: %v", fake.requests)
+	}
+	if !bytes.Equal(fake.object("big"), data[500:]) {
+		t.Fatalf("uploaded object is not the rest of the stream")
+	}
+
+	if journalPath("dir", "http://a", "b", "k") == journalPath("dir", "http://c", "b", "k") {
+		t.Fatalf("journals of two endpoints collide")
+	}
+}
+
+func TestAbortStaleUploads(t *testing.T) {
+	s, fake, journalDir := newTestResumableStore(t)
+	data := make([]byte, 3*1024)
+	fake.failPart = 2
+	if err := s.WriteRaw("dir/big", bytes.NewReader(data)); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+
+	aborted, err := s.AbortStaleUploads(context.Background(), "other/", 0)
+	if err != nil || aborted != 0 {
+		t.Fatalf("abort below another prefix: %d %v", aborted, err)
+	}
+	aborted, err = s.AbortStaleUploads(context.Background(), "dir/", 0)
+	if err != nil || aborted != 1 {
+		t.Fatalf("abort stale uploads: %d %v", aborted, err)
+	}
+	if len(fake.uploads) != 0 {
+		t.Fatalf("uploads left: %v", fake.uploads)
+	}
+	if journals, _ := filepath.Glob(filepath.Join(journalDir, "*.json")); len(journals) != 0 {
+		t.Fatalf("journals left: %v", journals)
+	}
+}
@@ -0,0 +1,151 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var _ UploadSigner = &s3BlobStore{}
+
+const (
+	postPolicyAlgorithm  = "AWS4-HMAC-SHA256"
+	postPolicyDateFormat = "20060102T150405Z"
+	// maxObjectSize the largest object s3 accepts, the upper bound of an open size range
+	maxObjectSize = 5 << 40
+)
+
+// GetSignedPutURL presigns with the displayHost client, like GetSignedURL
+func (s *s3BlobStore) GetSignedPutURL(ctx context.Context, path string, expire time.Duration, opts SignedPutOptions) (*SignedRequest, error) {
+	signed, err := s.getSignedPutURL(ctx, path, expire, opts)
+	return signed, newS3Error("GetSignedPutURL", path, err)
+}
+
+func (s *s3BlobStore) getSignedPutURL(ctx context.Context, path string, expire time.Duration, opts SignedPutOptions) (*SignedRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bucket, key, err := s.getBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentLength > 0 {
+		input.ContentLength = aws.Int64(opts.ContentLength)
+	}
+	req, _ := s.signedClient.PutObjectRequest(input)
+	req.SetContext(ctx)
+	if expire == 0 {
+		expire = defaultExpire
+	}
+	signedURL, signedHeader, err := req.PresignRequest(expire)
+	if err != nil {
+		return nil, err
+	}
+	// the sdk returns lower case keys
+	header := make(http.Header, len(signedHeader))
+	for k, v := range signedHeader {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+	return &SignedRequest{Method: http.MethodPut, URL: signedURL, Header: header}, nil
+}
+
+// GetSignedPostPolicy signs a SigV4 POST policy with the displayHost client's credentials
+func (s *s3BlobStore) GetSignedPostPolicy(ctx context.Context, prefix string, expire time.Duration, opts PostPolicyOptions) (*PostPolicy, error) {
+	policy, err := s.getSignedPostPolicy(ctx, prefix, expire, opts)
+	return policy, newS3Error("GetSignedPostPolicy", prefix, err)
+}
+
+func (s *s3BlobStore) getSignedPostPolicy(ctx context.Context, prefix string, expire time.Duration, opts PostPolicyOptions) (*PostPolicy, error) {
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return nil, fmt.Errorf("min size %d is larger than max size %d", opts.MinSize, opts.MaxSize)
+	}
+	bucket, key, err := s.getBucketAndKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	// the sdk drops the leading slash from the request path, the key of a form has none
+	keyPrefix := strings.TrimPrefix(key, Delimiter)
+	if strings.HasSuffix(prefix, Delimiter) && keyPrefix != "" {
+		keyPrefix += Delimiter
+	}
+	creds, err := s.signedClient.Config.Credentials.GetWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if expire == 0 {
+		expire = defaultExpire
+	}
+	now := time.Now().UTC()
+	region := aws.StringValue(s.signedClient.Config.Region)
+	scope := strings.Join([]string{now.Format("20060102"), region, s3.ServiceName, "aws4_request"}, "/")
+
+	fields := map[string]string{
+		"key":              keyPrefix + "${filename}",
+		"x-amz-algorithm":  postPolicyAlgorithm,
+		"x-amz-credential": creds.AccessKeyID + "/" + scope,
+		"x-amz-date":       now.Format(postPolicyDateFormat),
+	}
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+		[]string{"starts-with", "$key", keyPrefix},
+		map[string]string{"x-amz-algorithm": fields["x-amz-algorithm"]},
+		map[string]string{"x-amz-credential": fields["x-amz-credential"]},
+		map[string]string{"x-amz-date": fields["x-amz-date"]},
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+		conditions = append(conditions, map[string]string{"x-amz-security-token": creds.SessionToken})
+	}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, map[string]string{"Content-Type": opts.ContentType})
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		maxSize := opts.MaxSize
+		if maxSize <= 0 {
+			maxSize = maxObjectSize
+		}
+		conditions = append(conditions, []interface{}{"content-length-range", opts.MinSize, maxSize})
+	}
+	expiration := now.Add(expire)
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": expiration.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields["policy"] = base64.StdEncoding.EncodeToString(document)
+	fields["x-amz-signature"] = hex.EncodeToString(postPolicySignature(creds.SecretAccessKey, now, region, fields["policy"]))
+
+	return &PostPolicy{
+		URL:        strings.TrimSuffix(s.signedClient.Endpoint, Delimiter) + Delimiter + bucket,
+		Fields:     fields,
+		Expiration: expiration,
+	}, nil
+}
+
+// postPolicySignature signs the base64 policy with the SigV4 signing key of the day
+func postPolicySignature(secret string, date time.Time, region, policy string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date.Format("20060102"), region, s3.ServiceName, "aws4_request", policy} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return key
+}
@@ -0,0 +1,119 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// newTestPresignStore builds a store for presigning only, nothing is sent to the hosts
+func newTestPresignStore(t *testing.T) *s3BlobStore {
+	signedClient, err := newSignedClient("https://cdn.example.com", aws.Config{
+		Credentials:      credentials.NewStaticCredentials("ak", "sk", ""),
+		Endpoint:         aws.String("http://s3.internal:9000"),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatalf("new signed client error: %v", err)
+	}
+	return &s3BlobStore{signedClient: signedClient, bucket: "my-bucket", subPath: "/sub"}
+}
+
+func TestGetSignedPutURL(t *testing.T) {
+	s := newTestPresignStore(t)
+	signed, err := s.GetSignedPutURL(context.Background(), "upload/hello world", time.Minute, SignedPutOptions{
+		ContentType:   "image/png",
+		ContentLength: 1024,
+	})
+	if err != nil {
+		t.Fatalf("get signed put url error: %v", err)
+	}
+	u, err := url.Parse(signed.URL)
+	if err != nil {
+		t.Fatalf("parse url error: %v", err)
+	}
+	if signed.Method != "PUT" || u.Host != "cdn.example.com" || u.Path != "/my-bucket/sub/upload/hello world" {
+		t.Fatalf("signed put: %s %s", signed.Method, signed.URL)
+	}
+	if got := u.Query().Get("X-Amz-SignedHeaders"); got != "content-length;content-type;host" {
+		t.Fatalf("signed headers: %s", got)
+	}
+	if signed.Header.Get("Content-Type") != "image/png" || signed.Header.Get("Content-Length") != "1024" {
+		t.Fatalf("headers to send: %v", signed.Header)
+	}
+
+	signed, err = s.GetSignedPutURL(context.Background(), "upload/any", 0, SignedPutOptions{})
+	if err != nil {
+		t.Fatalf("get signed put url error: %v", err)
+	}
+	if !strings.Contains(signed.URL, "X-Amz-SignedHeaders=host&") || !strings.Contains(signed.URL, "X-Amz-Expires=43200") {
+		t.Fatalf("unpinned signed put: %s", signed.URL)
+	}
+}
+
+func TestGetSignedPostPolicy(t *testing.T) {
+	s := newTestPresignStore(t)
+	policy, err := s.GetSignedPostPolicy(context.Background(), "upload/", time.Hour, PostPolicyOptions{
+		ContentType: "image/png",
+		MaxSize:     1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("get signed post policy error: %v", err)
+	}
+	if policy.URL != "https://cdn.example.com/my-bucket" {
+		t.Fatalf("post url: %s", policy.URL)
+	}
+	fields := policy.Fields
+	if fields["key"] != "sub/upload/${filename}" || fields["Content-Type"] != "image/png" ||
+		!strings.HasPrefix(fields["x-amz-credential"], "ak/") || len(fields["x-amz-signature"]) != 64 {
+		t.Fatalf("post fields: %v", fields)
+	}
+
+	document, err := base64.StdEncoding.DecodeString(fields["policy"])
+	if err != nil {
+		t.Fatalf("decode policy error: %v", err)
+	}
+	var decoded struct {
+		Expiration string            `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err = json.Unmarshal(document, &decoded); err != nil {
+		t.Fatalf("unmarshal policy error: %v", err)
+	}
+	conditions := make([]string, len(decoded.Conditions))
+	for i, condition := range decoded.Conditions {
+		conditions[i] = string(condition)
+	}
+	for _, want := range []string{
+		`{"bucket":"my-bucket"}`,
+		`["starts-with","$key","sub/upload/"]`,
+		`{"Content-Type":"image/png"}`,
+		`["content-length-range",0,1048576]`,
+	} {
+		if !strings.Contains(strings.Join(conditions, "\n"), want) {
+			t.Fatalf("conditions %v do not contain %s", conditions, want)
+		}
+	}
+	if expiration, err := time.Parse(time.RFC3339, decoded.Expiration); err != nil || !expiration.Equal(policy.Expiration.Truncate(time.Millisecond)) {
+		t.Fatalf("expiration: %s %v, want %v", decoded.Expiration, err, policy.Expiration)
+	}
+
+	other := newTestPresignStore(t)
+	other.signedClient.Config.Credentials = credentials.NewStaticCredentials("ak", "other", "")
+	otherPolicy, err := other.getSignedPostPolicy(context.Background(), "upload/", time.Hour, PostPolicyOptions{})
+	if err != nil || otherPolicy.Fields["x-amz-signature"] == fields["x-amz-signature"] {
+		t.Fatalf("signature does not depend on the secret: %v", err)
+	}
+
+	if _, err = s.GetSignedPostPolicy(context.Background(), "upload/", 0, PostPolicyOptions{MinSize: 10, MaxSize: 1}); err == nil {
+		t.Fatalf("min size above max size accepted")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func TestS3GetMeta(t *testing.T) {
@@ -34,7 +37,7 @@ func TestS3GetMeta(t *testing.T) {
 		},
 	}
 
-	bs := bsSet[BlobStoreMinio]
+	bs := minioBlobStore(t)
 	content := "hello world"
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -63,7 +66,7 @@ func equal(meta, wantMeta BlobMeta) bool {
 }
 
 func TestS3BuildURL(t *testing.T) {
-	bs := bsSet[BlobStoreMinio]
+	bs := minioBlobStore(t)
 	bucket := bs.(*s3BlobStore).bucket
 	subPath := bs.(*s3BlobStore).subPath
 
@@ -96,3 +99,38 @@ func TestS3BuildURL(t *testing.T) {
 		})
 	}
 }
+
+func TestHeadObjectChecksum(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		output *s3.HeadObjectOutput
+		want   string
+	}{
+		{
+			desc:   "no checksum",
+			output: &s3.HeadObjectOutput{},
+			want:   "",
+		},
+		{
+			desc:   "crc32c",
+			output: &s3.HeadObjectOutput{ChecksumCRC32C: aws.String("yZRlqg==")},
+			want:   "crc32c:yZRlqg==",
+		},
+		{
+			desc: "sha256 preferred",
+			output: &s3.HeadObjectOutput{
+				ChecksumCRC32:  aws.String("DUoRhQ=="),
+				ChecksumSHA256: aws.String("uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="),
+			},
+			want: "sha256:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := headObjectChecksum(tc.output); got != tc.want {
+				t.Fatalf("checksum: %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package filesystem
+
+import (
+	"container/list"
+	"math/bits"
+	pathpkg "path"
+	"sync"
+	"time"
+)
+
+// ConfigSignedURLCacheSize number of objects whose signed URLs are cached, 0 disables the cache
+const ConfigSignedURLCacheSize = "signedURLCacheSize"
+
+const (
+	defaultSignedURLCacheSize = 10000
+	// signedURLMinRemaining a cached URL is returned while at least this share of its validity remains
+	signedURLMinRemaining = 0.5
+	// signedURLMaxPerObject URLs kept per object, the one expiring first is dropped beyond
+	signedURLMaxPerObject = 8
+)
+
+// SignedURLCacheStats counters of the signed URL cache
+type SignedURLCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+	// Objects number of objects with cached URLs
+	Objects int `json:"objects"`
+}
+
+// SignedURLCacheReporter is implemented by stores caching their signed URLs
+type SignedURLCacheReporter interface {
+	SignedURLCacheStats() SignedURLCacheStats
+}
+
+// signedURLCache a LRU of objects, each holding its URLs by expire bucket.
+// Writes and deletes through the same store invalidate the object, other writers are not seen.
+type signedURLCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	objects map[string]*list.Element
+	stats   SignedURLCacheStats
+	now     func() time.Time
+}
+
+type signedURLObject struct {
+	object string
+	urls   map[int]signedURL
+}
+
+type signedURL struct {
+	url       string
+	expiresAt time.Time
+}
+
+// newSignedURLCache returns nil for size <= 0, a nil cache caches nothing
+func newSignedURLCache(size int) *signedURLCache {
+	if size <= 0 {
+		return nil
+	}
+	return &signedURLCache{
+		size:    size,
+		lru:     list.New(),
+		objects: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func signedURLObjectKey(bucket, key string) string {
+	return bucket + pathpkg.Clean(Delimiter+key)
+}
+
+// signedURLExpireBucket groups the expire durations by power of two seconds, so callers
+// asking for slightly different durations share a URL signed for one of them
+func signedURLExpireBucket(expire time.Duration) int {
+	if expire < time.Second {
+		return 0
+	}
+	return bits.Len64(uint64(expire / time.Second))
+}
+
+func (c *signedURLCache) get(bucket, key string, expire time.Duration) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.objects[signedURLObjectKey(bucket, key)]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+	obj := elem.Value.(*signedURLObject)
+	cached, ok := obj.urls[signedURLExpireBucket(expire)]
+	if !ok || cached.expiresAt.Sub(c.now()) < time.Duration(float64(expire)*signedURLMinRemaining) {
+		c.stats.Misses++
+		return "", false
+	}
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	return cached.url, true
+}
+
+// put caches url signed now for expire
+func (c *signedURLCache) put(bucket, key string, expire time.Duration, url string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	object := signedURLObjectKey(bucket, key)
+	cached := signedURL{url: url, expiresAt: c.now().Add(expire)}
+	if elem, ok := c.objects[object]; ok {
+		elem.Value.(*signedURLObject).add(signedURLExpireBucket(expire), cached)
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.objects[object] = c.lru.PushFront(&signedURLObject{
+		object: object,
+		urls:   map[int]signedURL{signedURLExpireBucket(expire): cached},
+	})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.objects, oldest.Value.(*signedURLObject).object)
+		c.stats.Evictions++
+	}
+}
+
+func (o *signedURLObject) add(bucket int, cached signedURL) {
+	o.urls[bucket] = cached
+	for len(o.urls) > signedURLMaxPerObject {
+		first := -1
+		for b, u := range o.urls {
+			if b != bucket && (first < 0 || u.expiresAt.Before(o.urls[first].expiresAt)) {
+				first = b
+			}
+		}
+		delete(o.urls, first)
+	}
+}
+
+// invalidate drops the URLs of an overwritten or deleted object, so clients do not reuse stale cached content
+func (c *signedURLCache) invalidate(bucket, key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	object := signedURLObjectKey(bucket, key)
+	if elem, ok := c.objects[object]; ok {
+		c.lru.Remove(elem)
+		delete(c.objects, object)
+		c.stats.Invalidations++
+	}
+}
+
+func (c *signedURLCache) statsSnapshot() SignedURLCacheStats {
+	if c == nil {
+		return SignedURLCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Objects = c.lru.Len()
+	return stats
+}
@@ -0,0 +1,108 @@
+package filesystem
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignedURLCache(t *testing.T) {
+	now := time.Now()
+	c := newSignedURLCache(2)
+	c.now = func() time.Time { return now }
+
+	if _, ok := c.get("b", "/k", time.Hour); ok {
+		t.Fatalf("hit in an empty cache")
+	}
+	c.put("b", "/k", time.Hour, "url-1h")
+	c.put("b", "k", time.Minute, "url-1m")
+	if got, ok := c.get("b", "k", time.Hour); !ok || got != "url-1h" {
+		t.Fatalf("get: %s %v, want url-1h", got, ok)
+	}
+	if got, ok := c.get("b", "/k", time.Minute); !ok || got != "url-1m" {
+		t.Fatalf("get: %s %v, want url-1m", got, ok)
+	}
+
+	// less than half of the validity remains
+	now = now.Add(31 * time.Minute)
+	if _, ok := c.get("b", "/k", time.Hour); ok {
+		t.Fatalf("hit for a URL past half of its validity")
+	}
+
+	c.put("b", "/k2", time.Hour, "url-k2")
+	c.put("b", "/k3", time.Hour, "url-k3")
+	if _, ok := c.get("b", "/k", time.Minute); ok {
+		t.Fatalf("least recently used object was not evicted")
+	}
+	c.invalidate("b", "/k2")
+	if _, ok := c.get("b", "/k2", time.Hour); ok {
+		t.Fatalf("hit for an invalidated object")
+	}
+
+	want := SignedURLCacheStats{Hits: 2, Misses: 4, Evictions: 1, Invalidations: 1, Objects: 1}
+	if got := c.statsSnapshot(); got != want {
+		t.Fatalf("stats: %+v, want %+v", got, want)
+	}
+
+	// close durations share a bucket, the URL is returned while half of the requested validity remains
+	c.put("b", "/k4", time.Hour, "url-k4")
+	if got, ok := c.get("b", "/k4", 50*time.Minute); !ok || got != "url-k4" {
+		t.Fatalf("get in the same expire bucket: %s %v, want url-k4", got, ok)
+	}
+	now = now.Add(36 * time.Minute)
+	if _, ok := c.get("b", "/k4", 50*time.Minute); ok {
+		t.Fatalf("hit for a URL with less than half of the requested validity")
+	}
+
+	// the URLs of an object are capped
+	for i := 0; i < 16; i++ {
+		c.put("b", "/k5", time.Second<<i, "url")
+	}
+	c.mu.Lock()
+	urls := len(c.objects["b/k5"].Value.(*signedURLObject).urls)
+	c.mu.Unlock()
+	if urls != signedURLMaxPerObject {
+		t.Fatalf("urls of an object: %d, want %d", urls, signedURLMaxPerObject)
+	}
+	if got, ok := c.get("b", "/k5", time.Second<<15); !ok || got != "url" {
+		t.Fatalf("latest url of a capped object: %s %v", got, ok)
+	}
+
+	var disabled *signedURLCache
+	disabled.put("b", "/k", time.Hour, "url")
+	if _, ok := disabled.get("b", "/k", time.Hour); ok {
+		t.Fatalf("hit in a disabled cache")
+	}
+}
+
+func TestGetSignedURLCached(t *testing.T) {
+	s := newTestPresignStore(t)
+	s.urlCache = newSignedURLCache(defaultSignedURLCacheSize)
+	first, err := s.GetSignedURL("hello", time.Hour)
+	if err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := s.GetSignedURL("s3://my-bucket/sub/hello", time.Hour); err != nil || got != first {
+				t.Errorf("cached signed url: %s %v, want %s", got, err, first)
+			}
+		}()
+	}
+	wg.Wait()
+	if stats := s.SignedURLCacheStats(); stats.Hits != 8 || stats.Misses != 1 {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	s.urlCache.invalidate("my-bucket", "/sub/hello")
+	if _, err = s.GetSignedURLWithContext(context.Background(), "hello", time.Hour); err != nil {
+		t.Fatalf("get signed url error: %v", err)
+	}
+	if stats := s.SignedURLCacheStats(); stats.Misses != 2 || stats.Invalidations != 1 {
+		t.Fatalf("stats after invalidation: %+v", stats)
+	}
+}
@@ -0,0 +1,246 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pathpkg "path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncAction the action Sync takes for a file
+type SyncAction string
+
+const (
+	SyncCopy   SyncAction = "copy"
+	SyncDelete SyncAction = "delete"
+)
+
+// reasons a file is copied by Sync
+const (
+	syncMissing  = "missing"
+	syncSize     = "size"
+	syncChecksum = "checksum"
+	syncModified = "modified"
+)
+
+// SyncOptions of Sync
+type SyncOptions struct {
+	// Parallelism number of files copied or deleted concurrently, default 4
+	Parallelism int
+	// Checksum verifies every copied file, see CopyOptions
+	Checksum ChecksumAlgorithm
+	// DeleteExtraneous deletes destination files missing from the source
+	DeleteExtraneous bool
+	// DryRun only plans the actions, nothing is copied or deleted
+	DryRun bool
+}
+
+// SyncEntry an action planned by Sync
+type SyncEntry struct {
+	Action     SyncAction `json:"action"`
+	SourcePath string     `json:"sourcePath,omitempty"`
+	DestPath   string     `json:"destPath"`
+	Size       int64      `json:"size"`
+	// Reason why the file is copied: missing, size, checksum or modified
+	Reason string `json:"reason,omitempty"`
+	// Err the error of the action, nil for a dry run
+	Err error `json:"-"`
+}
+
+func (e *SyncEntry) String() string {
+	if e.Action == SyncDelete {
+		return fmt.Sprintf("%s %s", e.Action, e.DestPath)
+	}
+	return fmt.Sprintf("%s %s to %s (%s)", e.Action, e.SourcePath, e.DestPath, e.Reason)
+}
+
+// SyncResult the planned actions and how many of them succeeded
+type SyncResult struct {
+	Entries  []*SyncEntry  `json:"entries"`
+	Copied   int64         `json:"copied"`
+	Deleted  int64         `json:"deleted"`
+	Skipped  int64         `json:"skipped"`
+	Failed   int64         `json:"failed"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SyncError collects the failed actions of a Sync, the other actions were done
+type SyncError struct {
+	Entries []*SyncEntry
+}
+
+func (e *SyncError) Error() string {
+	first := e.Entries[0]
+	if len(e.Entries) == 1 {
+		return fmt.Sprintf("%v: %v", first, first.Err)
+	}
+	return fmt.Sprintf("%d actions failed, first: %v: %v", len(e.Entries), first, first.Err)
+}
+
+// Sync makes destPrefix of destBS a copy of sourcePrefix of sourceBS, unchanged files are skipped
+func Sync(sourceBS, destBS BlobStore, sourcePrefix, destPrefix string, opts SyncOptions) (*SyncResult, error) {
+	return SyncWithContext(context.Background(), sourceBS, destBS, sourcePrefix, destPrefix, opts)
+}
+
+// SyncWithContext lists both sides, then copies the new and changed files and
+// deletes the extraneous ones if asked to. A file is unchanged when the sizes match and
+// either a checksum both sides know matches, or the destination is not older than the source.
+func SyncWithContext(ctx context.Context, sourceBS, destBS BlobStore, sourcePrefix, destPrefix string, opts SyncOptions) (*SyncResult, error) {
+	if destBS == nil {
+		destBS = sourceBS
+	}
+	start := time.Now()
+	result := &SyncResult{}
+	entries, err := planSync(ctx, sourceBS, destBS, sourcePrefix, destPrefix, opts, result)
+	result.Entries = entries
+	if err != nil || opts.DryRun {
+		result.Duration = time.Since(start)
+		return result, err
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultCopyDirParallelism
+	}
+	var (
+		mu     sync.Mutex
+		failed []*SyncEntry
+		wg     sync.WaitGroup
+	)
+	jobs := make(chan *SyncEntry)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				if entry.Err = runSyncEntry(ctx, sourceBS, destBS, entry, opts); entry.Err != nil {
+					mu.Lock()
+					failed = append(failed, entry)
+					mu.Unlock()
+					atomic.AddInt64(&result.Failed, 1)
+					continue
+				}
+				if entry.Action == SyncDelete {
+					atomic.AddInt64(&result.Deleted, 1)
+					continue
+				}
+				atomic.AddInt64(&result.Copied, 1)
+				atomic.AddInt64(&result.Bytes, entry.Size)
+			}
+		}()
+	}
+	for _, entry := range entries {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+	result.Duration = time.Since(start)
+
+	if len(failed) > 0 {
+		return result, &SyncError{Entries: failed}
+	}
+	return result, ctx.Err()
+}
+
+// planSync lists both sides, a listing error aborts the sync:
+// a source file that could not be listed must not be deleted from the destination
+func planSync(ctx context.Context, sourceBS, destBS BlobStore, sourcePrefix, destPrefix string, opts SyncOptions, result *SyncResult) ([]*SyncEntry, error) {
+	destMetas := make(map[string]*BlobMeta)
+	destRel := newRelPath(destPrefix)
+	err := Walk(destBS, destPrefix, func(meta *BlobMeta, isDir bool, err error) error {
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if !isDir {
+			destMetas[destRel(meta)] = meta
+		}
+		return ctx.Err()
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	var entries []*SyncEntry
+	sourceRel := newRelPath(sourcePrefix)
+	err = Walk(sourceBS, sourcePrefix, func(meta *BlobMeta, isDir bool, err error) error {
+		if err != nil || isDir {
+			return err
+		}
+		rel := sourceRel(meta)
+		destMeta := destMetas[rel]
+		delete(destMetas, rel)
+		if reason := syncReason(meta, destMeta); reason != "" {
+			entries = append(entries, &SyncEntry{
+				Action:     SyncCopy,
+				SourcePath: pathpkg.Join(sourcePrefix, rel),
+				DestPath:   pathpkg.Join(destPrefix, rel),
+				Size:       meta.Size,
+				Reason:     reason,
+			})
+		} else {
+			result.Skipped++
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DeleteExtraneous {
+		extraneous := make([]string, 0, len(destMetas))
+		for rel := range destMetas {
+			extraneous = append(extraneous, rel)
+		}
+		sort.Strings(extraneous)
+		for _, rel := range extraneous {
+			entries = append(entries, &SyncEntry{
+				Action:   SyncDelete,
+				DestPath: pathpkg.Join(destPrefix, rel),
+				Size:     destMetas[rel].Size,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// syncReason returns why source has to be copied over dest, "" if dest is unchanged
+func syncReason(source, dest *BlobMeta) string {
+	if dest == nil {
+		return syncMissing
+	}
+	if source.Size != dest.Size {
+		return syncSize
+	}
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumSHA256, ChecksumCRC32C, ChecksumMD5} {
+		sourceSum, destSum := knownChecksum(source, algorithm), knownChecksum(dest, algorithm)
+		if sourceSum == "" || destSum == "" {
+			continue
+		}
+		if sourceSum != destSum {
+			return syncChecksum
+		}
+		return ""
+	}
+	if source.LastModified.After(dest.LastModified) {
+		return syncModified
+	}
+	return ""
+}
+
+func runSyncEntry(ctx context.Context, sourceBS, destBS BlobStore, entry *SyncEntry, opts SyncOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if entry.Action == SyncDelete {
+		return WithContext(destBS).DeleteRawWithContext(ctx, entry.DestPath)
+	}
+	return CopyRawWithOptions(ctx, sourceBS, destBS, entry.SourcePath, entry.DestPath, CopyOptions{Checksum: opts.Checksum})
+}
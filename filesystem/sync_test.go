@@ -0,0 +1,105 @@
+package filesystem
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	sourceBS := newTestMemBlobStore(t, "src/a", "src/b", "src/c/d")
+	destBS := newTestMemBlobStore(t, "dst/e")
+	for path, content := range map[string]string{
+		"dst/b": "src/b",
+		// same size, other content
+		"dst/c/d": "xxxxxxx",
+	} {
+		if err := destBS.WriteRaw(path, strings.NewReader(content)); err != nil {
+			t.Fatalf("write raw error: %v", err)
+		}
+	}
+
+	result, err := Sync(sourceBS, destBS, "src", "dst", SyncOptions{DeleteExtraneous: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run error: %v", err)
+	}
+	var planned []string
+	for _, entry := range result.Entries {
+		planned = append(planned, entry.String())
+	}
+	wantPlanned := "copy src/a to dst/a (missing),copy src/c/d to dst/c/d (checksum),delete dst/e"
+	if strings.Join(planned, ",") != wantPlanned || result.Skipped != 1 {
+		t.Fatalf("planned %v skipped %d, want %v", planned, result.Skipped, wantPlanned)
+	}
+	if _, err = destBS.GetMeta("dst/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("dry run copied: %v", err)
+	}
+
+	result, err = Sync(sourceBS, destBS, "src", "dst", SyncOptions{DeleteExtraneous: true})
+	if err != nil {
+		t.Fatalf("sync error: %v", err)
+	}
+	if result.Copied != 2 || result.Deleted != 1 || result.Bytes != int64(len("src/a")+len("src/c/d")) {
+		t.Fatalf("result: %+v", *result)
+	}
+	metas, err := destBS.ListMeta("dst", ListMetaOption{})
+	if err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if got := names(metas); got != "dst/a,dst/b,dst/c/d" {
+		t.Fatalf("synced names: %v", got)
+	}
+	out, err := destBS.ReadRaw("dst/c/d")
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	defer out.Close()
+	if content, _ := ioutil.ReadAll(out); string(content) != "src/c/d" {
+		t.Fatalf("changed file not copied: %q", content)
+	}
+
+	result, err = Sync(sourceBS, destBS, "src", "dst", SyncOptions{DeleteExtraneous: true})
+	if err != nil || len(result.Entries) != 0 || result.Skipped != 3 {
+		t.Fatalf("second sync: %v %+v", err, result)
+	}
+}
+
+func TestSyncLocalModified(t *testing.T) {
+	bs := bsSet[BlobStoreLocal]
+	sourcePath, destPath := "my-bucket/sync-src/file", "my-bucket/sync-dst/file"
+	if err := bs.WriteRaw(sourcePath, strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	defer bs.DeleteRaw(sourcePath)
+	defer bs.DeleteRaw(destPath)
+
+	// a missing destination is empty
+	result, err := Sync(bs, bs, "my-bucket/sync-src", "my-bucket/sync-dst", SyncOptions{})
+	if err != nil || result.Copied != 1 {
+		t.Fatalf("first sync: %v %+v", err, result)
+	}
+	result, err = Sync(bs, bs, "my-bucket/sync-src", "my-bucket/sync-dst", SyncOptions{})
+	if err != nil || result.Skipped != 1 || len(result.Entries) != 0 {
+		t.Fatalf("unchanged sync: %v %+v", err, result)
+	}
+
+	if err = bs.WriteRaw(sourcePath, strings.NewReader("world")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	// the rewrite may fall into the same mtime tick as the copy
+	fullPath, err := bs.(*localBlobStore).getFullPath(sourcePath)
+	if err != nil {
+		t.Fatalf("get full path error: %v", err)
+	}
+	modified := time.Now().Add(time.Minute)
+	if err = os.Chtimes(fullPath, modified, modified); err != nil {
+		t.Fatalf("chtimes error: %v", err)
+	}
+	result, err = Sync(bs, bs, "my-bucket/sync-src", "my-bucket/sync-dst", SyncOptions{})
+	if err != nil || len(result.Entries) != 1 || result.Entries[0].Reason != syncModified {
+		t.Fatalf("modified sync: %v %+v", err, result)
+	}
+}
@@ -0,0 +1,304 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute a key value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attributes set on the spans of WithTracing
+const (
+	AttributeKind   = "blobstore.kind"
+	AttributeBucket = "blobstore.bucket"
+	AttributeKey    = "blobstore.key"
+	// AttributeSize bytes read or written by the call, or of the metas returned by GetMeta, ListMeta and ListPage
+	AttributeSize = "blobstore.size"
+	// AttributeResult "ok" or the ErrorClass of the failure
+	AttributeResult = "blobstore.result"
+)
+
+// Tracer starts the spans of WithTracing, it mirrors the OpenTelemetry tracer so one can be adapted
+type Tracer interface {
+	// Start starts a span, the returned context carries it for the child spans
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span an operation being traced
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// SpanData a span ended by the Tracer of NewTracer
+type SpanData struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	// Err the error recorded by the span, nil if it succeeded
+	Err error
+}
+
+// SpanExporter receives the spans of the Tracer of NewTracer once they end
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// NewTracer returns a Tracer exporting its spans to exporter
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter SpanExporter
+}
+
+type spanContextKey struct{}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &span{tracer: t, data: SpanData{
+		Name:       name,
+		SpanID:     newTraceID(8),
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}, len(attrs)),
+	}}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.data.TraceID, s.data.ParentSpanID = parent.data.TraceID, parent.data.SpanID
+	} else {
+		s.data.TraceID = newTraceID(16)
+	}
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+func newTraceID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End exports the span, only the first call is effective
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.exporter.ExportSpan(data)
+}
+
+// InMemoryExporter keeps the exported spans, for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+var _ SpanExporter = &InMemoryExporter{}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans the exported spans in the order they ended
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops the exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// WithTracing returns bs opening a span named "blobstore.<op>" per call.
+// The span of a stream read ends when the stream is closed.
+func WithTracing(bs BlobStore, tracer Tracer) BlobStore {
+	return &wrappedBlobStore{inner: bs, mw: &tracingMiddleware{inner: unwrapBlobStore(bs), tracer: tracer}}
+}
+
+type tracingMiddleware struct {
+	// inner the innermost store, it resolves the bucket and key of a path
+	inner  BlobStore
+	tracer Tracer
+}
+
+var _ middleware = &tracingMiddleware{}
+
+// target the kind, bucket and key of path
+func (t *tracingMiddleware) target(path string) (Kind, string, string) {
+	switch bs := t.inner.(type) {
+	case *s3BlobStore:
+		if bucket, key, err := bs.getBucketAndKey(path); err == nil {
+			return KindS3, bucket, strings.TrimPrefix(key, Delimiter)
+		}
+		return KindS3, "", path
+	case *memBlobStore:
+		if key, err := bs.getKey(path); err == nil {
+			return KindMem, bs.name, key
+		}
+		return KindMem, bs.name, path
+	case *mountBlobStore:
+		return bs.kind, "", path
+	case *localBlobStore:
+		return KindLocal, "", path
+	}
+	return "", "", path
+}
+
+func (t *tracingMiddleware) start(ctx context.Context, op, path string) (context.Context, Span) {
+	kind, bucket, key := t.target(path)
+	attrs := []Attribute{{Key: AttributeKind, Value: string(kind)}, {Key: AttributeKey, Value: key}}
+	if bucket != "" {
+		attrs = append(attrs, Attribute{Key: AttributeBucket, Value: bucket})
+	}
+	return t.tracer.Start(ctx, "blobstore."+op, attrs...)
+}
+
+// endSpan records the result of the call and ends span
+func endSpan(span Span, err error) {
+	result := "ok"
+	if err != nil {
+		result = ErrorClass(err)
+		span.RecordError(err)
+	}
+	span.SetAttributes(Attribute{Key: AttributeResult, Value: result})
+	span.End()
+}
+
+func (t *tracingMiddleware) call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error {
+	ctx, span := t.start(ctx, op, path)
+	size := int64(-1)
+	err := fn(withCallSize(ctx, &size))
+	if size >= 0 {
+		// the bytes of the returned metas, GetMeta, ListMeta and ListPage report them
+		span.SetAttributes(Attribute{Key: AttributeSize, Value: size})
+	}
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingMiddleware) read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	ctx, span := t.start(ctx, op, path)
+	rc, err := fn(ctx)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedReadCloser{rc: rc, span: span}, nil
+}
+
+func (t *tracingMiddleware) write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error {
+	ctx, span := t.start(ctx, op, path)
+	counter := &byteCounter{}
+	if seeker, ok := in.(io.Seeker); ok {
+		// a reader that cannot tell its offset is counted from 0
+		counter.start, _ = seeker.Seek(0, io.SeekCurrent)
+	}
+	err := fn(ctx, hookReader(in, counter.read, counter.seek))
+	span.SetAttributes(Attribute{Key: AttributeSize, Value: counter.n})
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracingMiddleware) download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error) {
+	ctx, span := t.start(ctx, op, path)
+	n, err := fn(ctx, wa)
+	span.SetAttributes(Attribute{Key: AttributeSize, Value: n})
+	endSpan(span, err)
+	return n, err
+}
+
+// byteCounter counts the bytes read. Once seeked, n is the furthest offset read from the start,
+// reset by a seek back to the start, so rewinds and resumed parts are not counted twice.
+type byteCounter struct {
+	n          int64
+	start, off int64
+}
+
+func (c *byteCounter) read(n int) error {
+	if c.off += int64(n); c.off > c.n {
+		c.n = c.off
+	}
+	return nil
+}
+
+func (c *byteCounter) seek(pos int64) {
+	if c.off = pos - c.start; c.off <= 0 {
+		c.n = 0
+	}
+}
+
+// tracedReadCloser ends the span of a read once closed, with the bytes read and the first read error
+type tracedReadCloser struct {
+	rc   io.ReadCloser
+	span Span
+	n    int64
+	err  error
+	once sync.Once
+}
+
+func (r *tracedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *tracedReadCloser) Close() error {
+	err := r.rc.Close()
+	r.once.Do(func() {
+		if r.err == nil {
+			r.err = err
+		}
+		r.span.SetAttributes(Attribute{Key: AttributeSize, Value: r.n})
+		endSpan(r.span, r.err)
+	})
+	return err
+}
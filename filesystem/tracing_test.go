@@ -0,0 +1,131 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := NewTracer(exporter)
+	bs := WithTracing(newTestMemBlobStore(t), tracer)
+
+	ctx, parent := tracer.Start(context.Background(), "job")
+	if err := WithContext(bs).WriteRawWithContext(ctx, "dir/a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("write raw error: %v", err)
+	}
+	stream, err := WithContext(bs).ReadRawWithContext(ctx, "dir/a")
+	if err != nil {
+		t.Fatalf("read raw error: %v", err)
+	}
+	if got := len(exporter.Spans()); got != 1 {
+		t.Fatalf("spans before the stream is closed: %d, want 1", got)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if content, err := ioutil.ReadAll(stream); err != nil || string(content) != "hello" {
+		t.Fatalf("read %q: %v", content, err)
+	}
+	stream.Close()
+	if _, err = WithContext(bs).GetMetaWithContext(ctx, "missing"); err == nil {
+		t.Fatalf("get meta of a missing path succeeded")
+	}
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("spans: %+v", spans)
+	}
+	write, read, getMeta, job := spans[0], spans[1], spans[2], spans[3]
+	for _, span := range []SpanData{write, read, getMeta} {
+		if span.TraceID != job.TraceID || span.ParentSpanID != job.SpanID {
+			t.Fatalf("span %s is not a child of the job span: %+v", span.Name, span)
+		}
+		if span.Attributes[AttributeKind] != KindMem || span.Attributes[AttributeBucket] != "test" {
+			t.Fatalf("span %s attributes: %v", span.Name, span.Attributes)
+		}
+	}
+	if write.Name != "blobstore.WriteRaw" || write.Attributes[AttributeSize] != int64(5) ||
+		write.Attributes[AttributeResult] != "ok" || !strings.HasSuffix(write.Attributes[AttributeKey].(string), "dir/a") {
+		t.Fatalf("write span: %+v", write)
+	}
+	// the read span covers the stream
+	if read.Name != "blobstore.ReadRaw" || read.Attributes[AttributeSize] != int64(5) || read.End.Sub(read.Start) < 10*time.Millisecond {
+		t.Fatalf("read span: %+v", read)
+	}
+	if getMeta.Name != "blobstore.GetMeta" || getMeta.Attributes[AttributeResult] != "not_found" || !errors.Is(getMeta.Err, ErrNotFound) {
+		t.Fatalf("get meta span: %+v", getMeta)
+	}
+
+	exporter.Reset()
+	if got := len(exporter.Spans()); got != 0 {
+		t.Fatalf("spans after reset: %d", got)
+	}
+}
+
+func TestWithTracingNested(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	tracer := NewTracer(exporter)
+	bs := WithTracing(WithRetry(WithTracing(newTestMemBlobStore(t, "a"), tracer), RetryOptions{}), tracer)
+	if _, err := bs.GetMeta("a"); err != nil {
+		t.Fatalf("get meta error: %v", err)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("spans: %+v", spans)
+	}
+	inner, outer := spans[0], spans[1]
+	if inner.TraceID != outer.TraceID || inner.ParentSpanID != outer.SpanID || outer.ParentSpanID != "" {
+		t.Fatalf("inner span %+v is not a child of %+v", inner, outer)
+	}
+	// the kind is resolved through the wrappers
+	if outer.Attributes[AttributeKind] != KindMem {
+		t.Fatalf("outer span attributes: %v", outer.Attributes)
+	}
+	for _, span := range spans {
+		if span.Attributes[AttributeSize] != int64(1) {
+			t.Fatalf("get meta span size: %v", span.Attributes)
+		}
+	}
+}
+
+func TestWithTracingSize(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	bs := WithTracing(newTestMemBlobStore(t, "dir/a", "dir/bb"), NewTracer(exporter))
+	if _, err := bs.ListMeta("dir", ListMetaOption{}); err != nil {
+		t.Fatalf("list meta error: %v", err)
+	}
+	if _, err := ListPage(bs, "dir", "", 10); err != nil {
+		t.Fatalf("list page error: %v", err)
+	}
+	for _, span := range exporter.Spans() {
+		if span.Attributes[AttributeSize] != int64(len("dir/a")+len("dir/bb")) {
+			t.Fatalf("span %s size: %v", span.Name, span.Attributes)
+		}
+	}
+
+	// the resumed parts and the seeks of a resumable upload are counted once
+	s, fake, _ := newTestResumableStore(t)
+	s.transfer.concurrency = 1
+	data := make([]byte, 3*1024+100)
+	in := bytes.NewReader(data)
+	in.Seek(100, io.SeekStart)
+	fake.failPart = 2
+	bs = WithTracing(s, NewTracer(exporter))
+	if err := bs.WriteRaw("big", in); err == nil {
+		t.Fatalf("interrupted upload succeeded")
+	}
+	in.Seek(100, io.SeekStart)
+	if err := bs.WriteRaw("big", in); err != nil {
+		t.Fatalf("resumed upload error: %v", err)
+	}
+	spans := exporter.Spans()
+	if write := spans[len(spans)-1]; write.Attributes[AttributeSize] != int64(3*1024) {
+		t.Fatalf("write span size: %v", write.Attributes)
+	}
+}
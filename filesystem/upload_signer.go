@@ -0,0 +1,45 @@
+package filesystem
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// UploadSigner is implemented by stores able to presign uploads going directly
+// from a client such as a browser to the store
+type UploadSigner interface {
+	// GetSignedPutURL presigns a PUT of path, the client must send the returned Header with it
+	GetSignedPutURL(ctx context.Context, path string, expire time.Duration, opts SignedPutOptions) (*SignedRequest, error)
+	// GetSignedPostPolicy presigns a form upload of any key below prefix
+	GetSignedPostPolicy(ctx context.Context, prefix string, expire time.Duration, opts PostPolicyOptions) (*PostPolicy, error)
+}
+
+// SignedPutOptions pin what a presigned PUT accepts, zero values are not pinned
+type SignedPutOptions struct {
+	ContentType   string
+	ContentLength int64
+}
+
+// SignedRequest a presigned request, Header holds the signed headers the client must send unchanged
+type SignedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+// PostPolicyOptions constrain a presigned form upload, zero values are not constrained
+type PostPolicyOptions struct {
+	// ContentType the exact Content-Type field of the form
+	ContentType string
+	MinSize     int64
+	MaxSize     int64
+}
+
+// PostPolicy the form of a presigned upload: the client posts Fields, its own key
+// below the prefix if it wants another one than the file name, and the file to URL
+type PostPolicy struct {
+	URL        string            `json:"url"`
+	Fields     map[string]string `json:"fields"`
+	Expiration time.Time         `json:"expiration"`
+}
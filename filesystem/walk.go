@@ -0,0 +1,133 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	pathpkg "path"
+	"strings"
+)
+
+var (
+	// SkipDir returned by a WalkFunc for a directory skips its content,
+	// returned for a file it skips the remaining entries of the file's directory
+	SkipDir = fs.SkipDir
+	// SkipAll returned by a WalkFunc stops the walk, Walk then returns nil
+	SkipAll = errors.New("skip everything and stop the walk")
+)
+
+// WalkFunc is called for every file and directory below the walked path, the path itself is not visited.
+// err is the per-entry error, e.g. a directory that could not be read, meta then carries at least Name.
+// Returning nil for a failed entry continues the walk, any error other than SkipDir and SkipAll aborts it.
+type WalkFunc func(meta *BlobMeta, isDir bool, err error) error
+
+// Walker streams the entries below path instead of materializing them like ListMeta
+type Walker interface {
+	Walk(path string, fn WalkFunc) error
+}
+
+// ContextWalker a Walker whose walk stops when ctx is done
+type ContextWalker interface {
+	WalkWithContext(ctx context.Context, path string, fn WalkFunc) error
+}
+
+// Walk uses the native walk of bs, other stores are walked page by page with ListPage
+func Walk(bs BlobStore, path string, fn WalkFunc) error {
+	return WalkWithContext(context.Background(), bs, path, fn)
+}
+
+// WalkWithContext is Walk stopping when ctx is done
+func WalkWithContext(ctx context.Context, bs BlobStore, path string, fn WalkFunc) error {
+	if walker, ok := bs.(ContextWalker); ok {
+		return walker.WalkWithContext(ctx, path, fn)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if walker, ok := bs.(Walker); ok {
+		return walker.Walk(path, fn)
+	}
+	w := newFlatWalker(strings.Trim(pathpkg.Clean("/"+path), Delimiter), fn)
+	cursor := ""
+	for {
+		page, err := ListPageWithContext(ctx, bs, path, cursor, MaxKeys)
+		if err != nil {
+			return err
+		}
+		for _, meta := range page.Metas {
+			if err = w.visit(meta); err != nil {
+				return w.result(err)
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// flatWalker walks flat object names such as s3 keys, directories are made up from the names.
+// Names must arrive grouped by directory, as lexical order or a depth-first walk produce them.
+type flatWalker struct {
+	root string
+	fn   WalkFunc
+	// dirs the directories of the previous name, relative to root
+	dirs []string
+	// skip names below it are dropped
+	skip string
+}
+
+func newFlatWalker(root string, fn WalkFunc) *flatWalker {
+	return &flatWalker{root: root, fn: fn}
+}
+
+func (w *flatWalker) visit(meta *BlobMeta) error {
+	name := strings.Trim(meta.Name, Delimiter)
+	if w.skip != "" && strings.HasPrefix(name, w.skip+Delimiter) {
+		return nil
+	}
+	rel := name
+	if w.root != "" {
+		rel = strings.TrimPrefix(name, w.root+Delimiter)
+	}
+	dirs := strings.Split(rel, Delimiter)
+	dirs = dirs[:len(dirs)-1]
+
+	common := 0
+	for common < len(dirs) && common < len(w.dirs) && dirs[common] == w.dirs[common] {
+		common++
+	}
+	w.dirs = dirs
+	for i := common; i < len(dirs); i++ {
+		dir := strings.Join(dirs[:i+1], Delimiter)
+		if w.root != "" {
+			dir = w.root + Delimiter + dir
+		}
+		err := w.fn(&BlobMeta{Name: dir, IsDir: true}, true, nil)
+		if err == SkipDir {
+			w.skip = dir
+			w.dirs = dirs[:i]
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := w.fn(meta, false, nil)
+	if err == SkipDir && len(dirs) > 0 {
+		// skip the rest of the parent directory, for files directly below root the walk ends
+		w.skip = name[:strings.LastIndex(name, Delimiter)]
+		w.dirs = dirs[:len(dirs)-1]
+		return nil
+	}
+	return err
+}
+
+// result turns the error that stopped the walk into the error returned by Walk
+func (w *flatWalker) result(err error) error {
+	if err == SkipAll || err == SkipDir {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	files := []string{"a/1", "a/b/2", "a/b.txt", "a/b/c/3", "a/d", "e"}
+	root := "my-bucket/walk"
+	errStop := errors.New("stop")
+
+	testCases := []struct {
+		desc      string
+		fn        func(rel string, isDir bool) error
+		wantFiles []string
+		wantDirs  []string
+		wantErr   error
+	}{
+		{
+			desc:      "all",
+			wantFiles: files,
+			wantDirs:  []string{"a", "a/b", "a/b/c"},
+		},
+		{
+			desc: "skip dir",
+			fn: func(rel string, isDir bool) error {
+				if rel == "a/b" {
+					return SkipDir
+				}
+				return nil
+			},
+			wantFiles: []string{"a/1", "a/b.txt", "a/d", "e"},
+			wantDirs:  []string{"a", "a/b"},
+		},
+		{
+			desc: "skip all",
+			fn: func(rel string, isDir bool) error {
+				if rel == "a/1" {
+					return SkipAll
+				}
+				return nil
+			},
+			wantFiles: []string{"a/1"},
+			wantDirs:  []string{"a"},
+		},
+		{
+			desc: "abort",
+			fn: func(rel string, isDir bool) error {
+				if rel == "a/1" {
+					return errStop
+				}
+				return nil
+			},
+			wantFiles: []string{"a/1"},
+			wantDirs:  []string{"a"},
+			wantErr:   errStop,
+		},
+	}
+
+	stores := newTestBlobStores(t)
+	for _, backend := range []string{BlobStoreLocal, BlobStoreMem} {
+		bs := stores[backend]
+		for _, file := range files {
+			if err := bs.WriteRaw(root+"/"+file, strings.NewReader(file)); err != nil {
+				t.Fatalf("write raw error: %v", err)
+			}
+			defer bs.DeleteRaw(root + "/" + file)
+		}
+
+		for _, tc := range testCases {
+			for _, wrapped := range []bool{false, true} {
+				walkBS := bs
+				desc := backend + " native " + tc.desc
+				if wrapped {
+					walkBS = struct{ BlobStore }{bs}
+					desc = backend + " fallback " + tc.desc
+				}
+				t.Run(desc, func(t *testing.T) {
+					gotFiles, gotDirs := make([]string, 0), make([]string, 0)
+					err := Walk(walkBS, root, func(meta *BlobMeta, isDir bool, err error) error {
+						if err != nil {
+							t.Fatalf("walk entry %s error: %v", meta.Name, err)
+						}
+						rel := strings.TrimPrefix(meta.Name, root+"/")
+						if isDir {
+							gotDirs = append(gotDirs, rel)
+						} else {
+							gotFiles = append(gotFiles, rel)
+						}
+						if tc.fn != nil {
+							return tc.fn(rel, isDir)
+						}
+						return nil
+					})
+					if err != tc.wantErr {
+						t.Fatalf("walk error: %v, want: %v", err, tc.wantErr)
+					}
+					if sorted(gotFiles) != sorted(tc.wantFiles) {
+						t.Fatalf("files: %v, want: %v", gotFiles, tc.wantFiles)
+					}
+					if sorted(gotDirs) != sorted(tc.wantDirs) {
+						t.Fatalf("dirs: %v, want: %v", gotDirs, tc.wantDirs)
+					}
+				})
+			}
+		}
+	}
+}
+
+func sorted(s []string) string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func TestWalkContextCanceled(t *testing.T) {
+	s, fake := newFakeS3Store(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for desc, bs := range map[string]BlobStore{"s3": s, "wrapped": WithRetry(s, RetryOptions{})} {
+		err := WalkWithContext(ctx, bs, "dir", func(meta *BlobMeta, isDir bool, err error) error { return nil })
+		if err == nil {
+			t.Fatalf("%s walk after cancel succeeded", desc)
+		}
+		if _, err = ListPageWithContext(ctx, bs, "dir", "", 10); err == nil {
+			t.Fatalf("%s list page after cancel succeeded", desc)
+		}
+	}
+	if len(fake.requests) != 0 {
+		t.Fatalf("requests sent after cancel: %v", fake.requests)
+	}
+}
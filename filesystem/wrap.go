@@ -0,0 +1,310 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Unwrapper is implemented by the stores decorating another store, such as WithRetry
+type Unwrapper interface {
+	Unwrap() BlobStore
+}
+
+// unwrapBlobStore returns the innermost store below the decorators
+func unwrapBlobStore(bs BlobStore) BlobStore {
+	for {
+		u, ok := bs.(Unwrapper)
+		if !ok {
+			return bs
+		}
+		bs = u.Unwrap()
+	}
+}
+
+// operation names passed to a middleware, they match the methods and the Op of a BlobError
+const (
+	opListMeta       = "ListMeta"
+	opGetMeta        = "GetMeta"
+	opReadRaw        = "ReadRaw"
+	opWriteRaw       = "WriteRaw"
+	opDeleteRaw      = "DeleteRaw"
+	opGetSignedURL   = "GetSignedURL"
+	opListPage       = "ListPage"
+	opWalk           = "Walk"
+	opReadRange      = "ReadRange"
+	opWriteOptions   = "WriteRawWithOptions"
+	opCopyRawFrom    = "CopyRawFrom"
+	opDownloadAt     = "DownloadAt"
+	opDownloadStream = "DownloadStream"
+)
+
+// middleware hooks into every call of a wrappedBlobStore
+type middleware interface {
+	// call runs an operation without a stream
+	call(ctx context.Context, op, path string, fn func(ctx context.Context) error) error
+	// read runs an operation opening a stream, the returned stream may be wrapped until Close
+	read(ctx context.Context, op, path string, fn func(ctx context.Context) (io.ReadCloser, error)) (io.ReadCloser, error)
+	// write runs an operation consuming in, fn must be given the reader to consume
+	write(ctx context.Context, op, path string, in io.Reader, fn func(ctx context.Context, in io.Reader) error) error
+	// download runs an operation writing into wa, fn must be given the io.WriterAt to write into
+	download(ctx context.Context, op, path string, wa io.WriterAt, fn func(ctx context.Context, wa io.WriterAt) (int64, error)) (int64, error)
+}
+
+type callSizeKey struct{}
+
+// withCallSize returns ctx collecting into size the bytes of the metas returned by a call,
+// for a middleware to see the result of the call it runs
+func withCallSize(ctx context.Context, size *int64) context.Context {
+	return context.WithValue(ctx, callSizeKey{}, size)
+}
+
+// setCallSize reports the bytes of the metas returned by the call of ctx
+func setCallSize(ctx context.Context, metas ...*BlobMeta) {
+	size, ok := ctx.Value(callSizeKey{}).(*int64)
+	if !ok {
+		return
+	}
+	*size = 0
+	for _, meta := range metas {
+		*size += meta.Size
+	}
+}
+
+// hookReader returns in calling onRead with the bytes of each read, a hook error fails the read.
+// If in can seek, so can the returned reader, so the store can still rewind or resume it,
+// and onSeek, if not nil, is called with each new offset.
+func hookReader(in io.Reader, onRead func(n int) error, onSeek func(pos int64)) io.Reader {
+	r := &hookedReader{r: in, onRead: onRead}
+	if seeker, ok := in.(io.Seeker); ok {
+		return &hookedReadSeeker{hookedReader: r, seeker: seeker, onSeek: onSeek}
+	}
+	return r
+}
+
+type hookedReader struct {
+	r      io.Reader
+	onRead func(n int) error
+}
+
+func (r *hookedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if hookErr := r.onRead(n); hookErr != nil && err == nil {
+		err = hookErr
+	}
+	return n, err
+}
+
+type hookedReadSeeker struct {
+	*hookedReader
+	seeker io.Seeker
+	onSeek func(pos int64)
+}
+
+func (r *hookedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil && r.onSeek != nil {
+		r.onSeek(pos)
+	}
+	return pos, err
+}
+
+// wrappedBlobStore runs every call of inner through a middleware.
+// The optional capabilities are forwarded through the package helpers, so they fall back like for inner.
+type wrappedBlobStore struct {
+	inner BlobStore
+	mw    middleware
+}
+
+var (
+	_ BlobStore          = &wrappedBlobStore{}
+	_ ContextBlobStore   = &wrappedBlobStore{}
+	_ Unwrapper          = &wrappedBlobStore{}
+	_ Pager              = &wrappedBlobStore{}
+	_ Walker             = &wrappedBlobStore{}
+	_ ContextPager       = &wrappedBlobStore{}
+	_ ContextWalker      = &wrappedBlobStore{}
+	_ RangeReader        = &wrappedBlobStore{}
+	_ OptionsWriter      = &wrappedBlobStore{}
+	_ Copier             = &wrappedBlobStore{}
+	_ ParallelDownloader = &wrappedBlobStore{}
+	_ copySourceChecker  = &wrappedBlobStore{}
+)
+
+func (w *wrappedBlobStore) Unwrap() BlobStore {
+	return w.inner
+}
+
+func (w *wrappedBlobStore) ListMeta(path string, option ListMetaOption) ([]*BlobMeta, error) {
+	return w.ListMetaWithContext(context.Background(), path, option)
+}
+
+func (w *wrappedBlobStore) ListMetaWithContext(ctx context.Context, path string, option ListMetaOption) ([]*BlobMeta, error) {
+	var metas []*BlobMeta
+	err := w.mw.call(ctx, opListMeta, path, func(ctx context.Context) (err error) {
+		if metas, err = WithContext(w.inner).ListMetaWithContext(ctx, path, option); err == nil {
+			setCallSize(ctx, metas...)
+		}
+		return err
+	})
+	return metas, newBlobError(opListMeta, path, err)
+}
+
+func (w *wrappedBlobStore) GetMeta(path string) (*BlobMeta, error) {
+	return w.GetMetaWithContext(context.Background(), path)
+}
+
+func (w *wrappedBlobStore) GetMetaWithContext(ctx context.Context, path string) (*BlobMeta, error) {
+	var meta *BlobMeta
+	err := w.mw.call(ctx, opGetMeta, path, func(ctx context.Context) (err error) {
+		if meta, err = WithContext(w.inner).GetMetaWithContext(ctx, path); err == nil {
+			setCallSize(ctx, meta)
+		}
+		return err
+	})
+	return meta, newBlobError(opGetMeta, path, err)
+}
+
+func (w *wrappedBlobStore) ReadRaw(path string) (io.ReadCloser, error) {
+	return w.ReadRawWithContext(context.Background(), path)
+}
+
+func (w *wrappedBlobStore) ReadRawWithContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := w.mw.read(ctx, opReadRaw, path, func(ctx context.Context) (io.ReadCloser, error) {
+		return WithContext(w.inner).ReadRawWithContext(ctx, path)
+	})
+	return rc, newBlobError(opReadRaw, path, err)
+}
+
+func (w *wrappedBlobStore) WriteRaw(path string, in io.Reader) error {
+	return w.WriteRawWithContext(context.Background(), path, in)
+}
+
+func (w *wrappedBlobStore) WriteRawWithContext(ctx context.Context, path string, in io.Reader) error {
+	err := w.mw.write(ctx, opWriteRaw, path, in, func(ctx context.Context, in io.Reader) error {
+		return WithContext(w.inner).WriteRawWithContext(ctx, path, in)
+	})
+	return newBlobError(opWriteRaw, path, err)
+}
+
+func (w *wrappedBlobStore) DeleteRaw(path string) error {
+	return w.DeleteRawWithContext(context.Background(), path)
+}
+
+func (w *wrappedBlobStore) DeleteRawWithContext(ctx context.Context, path string) error {
+	err := w.mw.call(ctx, opDeleteRaw, path, func(ctx context.Context) error {
+		return WithContext(w.inner).DeleteRawWithContext(ctx, path)
+	})
+	return newBlobError(opDeleteRaw, path, err)
+}
+
+func (w *wrappedBlobStore) GetSignedURL(path string, expire time.Duration) (string, error) {
+	return w.GetSignedURLWithContext(context.Background(), path, expire)
+}
+
+func (w *wrappedBlobStore) GetSignedURLWithContext(ctx context.Context, path string, expire time.Duration) (string, error) {
+	var signed string
+	err := w.mw.call(ctx, opGetSignedURL, path, func(ctx context.Context) (err error) {
+		signed, err = WithContext(w.inner).GetSignedURLWithContext(ctx, path, expire)
+		return err
+	})
+	return signed, newBlobError(opGetSignedURL, path, err)
+}
+
+func (w *wrappedBlobStore) BuildURL(path string) (string, error) {
+	return w.inner.BuildURL(path)
+}
+
+func (w *wrappedBlobStore) ListPage(path, cursor string, limit int64) (*MetaPage, error) {
+	return w.ListPageWithContext(context.Background(), path, cursor, limit)
+}
+
+func (w *wrappedBlobStore) ListPageWithContext(ctx context.Context, path, cursor string, limit int64) (*MetaPage, error) {
+	var page *MetaPage
+	err := w.mw.call(ctx, opListPage, path, func(ctx context.Context) (err error) {
+		if page, err = ListPageWithContext(ctx, w.inner, path, cursor, limit); err == nil {
+			setCallSize(ctx, page.Metas...)
+		}
+		return err
+	})
+	return page, newBlobError(opListPage, path, err)
+}
+
+func (w *wrappedBlobStore) Walk(path string, fn WalkFunc) error {
+	return w.WalkWithContext(context.Background(), path, fn)
+}
+
+func (w *wrappedBlobStore) WalkWithContext(ctx context.Context, path string, fn WalkFunc) error {
+	err := w.mw.call(ctx, opWalk, path, func(ctx context.Context) error {
+		return WalkWithContext(ctx, w.inner, path, fn)
+	})
+	return newBlobError(opWalk, path, err)
+}
+
+func (w *wrappedBlobStore) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := w.mw.read(context.Background(), opReadRange, path, func(ctx context.Context) (io.ReadCloser, error) {
+		return ReadRange(w.inner, path, offset, length)
+	})
+	return rc, newBlobError(opReadRange, path, err)
+}
+
+func (w *wrappedBlobStore) WriteRawWithOptions(path string, in io.Reader, opts WriteOptions) error {
+	err := w.mw.write(context.Background(), opWriteOptions, path, in, func(ctx context.Context, in io.Reader) error {
+		return WriteRawWithOptions(w.inner, path, in, opts)
+	})
+	return newBlobError(opWriteOptions, path, err)
+}
+
+func (w *wrappedBlobStore) canCopyFrom(source BlobStore) bool {
+	checker, ok := w.inner.(copySourceChecker)
+	return ok && checker.canCopyFrom(source)
+}
+
+// CopyRawFrom forwards to inner if it is a Copier. A copy inner cannot do is not a call of the store,
+// ErrUnsupported is returned without going through the middleware.
+func (w *wrappedBlobStore) CopyRawFrom(ctx context.Context, source BlobStore, sourcePath, destPath string) error {
+	copier, ok := w.inner.(Copier)
+	if !ok || !w.canCopyFrom(source) {
+		return newBlobError(opCopyRawFrom, destPath, fmt.Errorf("%w: copy from %T", ErrUnsupported, source))
+	}
+	var unsupported error
+	err := w.mw.call(ctx, opCopyRawFrom, destPath, func(ctx context.Context) error {
+		err := copier.CopyRawFrom(ctx, source, sourcePath, destPath)
+		if errors.Is(err, ErrUnsupported) {
+			// known once the source was inspected, e.g. below the parallel download threshold,
+			// the caller falls back to streaming so it does not count as a failed call
+			unsupported = err
+			return nil
+		}
+		return err
+	})
+	if unsupported != nil {
+		return unsupported
+	}
+	return newBlobError(opCopyRawFrom, destPath, err)
+}
+
+func (w *wrappedBlobStore) DownloadAt(ctx context.Context, path string, wa io.WriterAt) (int64, error) {
+	n, err := w.mw.download(ctx, opDownloadAt, path, wa, func(ctx context.Context, wa io.WriterAt) (int64, error) {
+		return DownloadAt(ctx, w.inner, path, wa)
+	})
+	return n, newBlobError(opDownloadAt, path, err)
+}
+
+// ParallelDownloadThreshold the threshold of the inner store, DownloadAt only streams the other stores
+func (w *wrappedBlobStore) ParallelDownloadThreshold() int64 {
+	if d, ok := w.inner.(ParallelDownloader); ok {
+		return d.ParallelDownloadThreshold()
+	}
+	return math.MaxInt64
+}
+
+func (w *wrappedBlobStore) DownloadStream(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := w.mw.read(ctx, opDownloadStream, path, func(ctx context.Context) (io.ReadCloser, error) {
+		return DownloadStream(ctx, w.inner, path)
+	})
+	return rc, newBlobError(opDownloadStream, path, err)
+}
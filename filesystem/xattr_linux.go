@@ -0,0 +1,39 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"errors"
+	"syscall"
+)
+
+// metaXattr holds the json encoded WriteOptions of a local file
+const metaXattr = "user.blobstore.meta"
+
+func setXattrWriteOptions(fullPath string, opts WriteOptions) error {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return syscall.Setxattr(fullPath, metaXattr, data, 0)
+}
+
+// getXattrWriteOptions returns nil if the file was written without options
+func getXattrWriteOptions(fullPath string) (*WriteOptions, error) {
+	size, err := syscall.Getxattr(fullPath, metaXattr, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENODATA) || errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data := make([]byte, size)
+	size, err = syscall.Getxattr(fullPath, metaXattr, data)
+	if err != nil {
+		return nil, err
+	}
+	opts := &WriteOptions{}
+	if err = json.Unmarshal(data[:size], opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
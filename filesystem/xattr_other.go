@@ -0,0 +1,15 @@
+//go:build !linux
+
+package filesystem
+
+import (
+	"fmt"
+)
+
+func setXattrWriteOptions(fullPath string, opts WriteOptions) error {
+	return fmt.Errorf("%w: xattrs are only used on linux", ErrUnsupported)
+}
+
+func getXattrWriteOptions(fullPath string) (*WriteOptions, error) {
+	return nil, nil
+}